@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/handlers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	// 初始化資料庫（如果還沒初始化）
+	if db.GetDB() == nil {
+		if err := db.InitDB(); err != nil {
+			http.Error(w, "Database initialization failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h := handlers.New(db.NewPostgresStore(db.GetDB()))
+
+	// 建立 Fiber 應用程式
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			code := fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				code = e.Code
+			}
+			return c.Status(code).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		},
+	})
+
+	// 中間件
+	app.Use(recover.New())
+	app.Use(logger.New())
+	app.Use(cors.New(cors.Config{
+		AllowOrigins: "*",
+		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
+		AllowHeaders: "Origin,Content-Type,Accept,Authorization,X-API-Key",
+	}))
+
+	// API 路由
+	api := app.Group("/api", h.Authenticate)
+	api.Get("/links", handlers.RequireAuth, h.ListLinks)
+	api.Get("/links/:short_code", h.GetLink)
+	api.Patch("/links/:short_code", h.UpdateLink)
+	api.Delete("/links/:short_code", h.DeleteLink)
+	api.Post("/links/:short_code/restore", h.RestoreLink)
+	api.Get("/links/:short_code/history", h.GetLinkHistory)
+	api.Post("/links/:short_code/preview/refresh", h.RefreshLinkPreview)
+	api.Get("/tags", handlers.RequireAuth, h.ListTags)
+	api.Get("/tags/:tag/stats", handlers.RequireAuth, h.GetTagStats)
+	api.Get("/campaigns", handlers.RequireAuth, h.ListCampaigns)
+	api.Get("/campaigns/:campaign/stats", handlers.RequireAuth, h.GetCampaignStats)
+
+	// API 金鑰管理
+	api.Post("/keys", handlers.RequireAuth, h.CreateAPIKey)
+	api.Get("/keys", handlers.RequireAuth, h.ListAPIKeys)
+	api.Delete("/keys/:id", handlers.RequireAuth, h.RevokeAPIKey)
+
+	// 處理請求
+	adaptor.FiberApp(app).ServeHTTP(w, r)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"net/http"
 
+	"go-shorturl/pkg/botdetect"
 	"go-shorturl/pkg/db"
 	"go-shorturl/pkg/handlers"
 
@@ -22,10 +23,23 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	bots, err := botdetect.NewFromEnv()
+	if err != nil {
+		http.Error(w, "Invalid bot IP ranges", http.StatusInternalServerError)
+		return
+	}
+	h := handlers.New(db.NewPostgresStore(db.GetDB()), handlers.WithBotDetector(bots))
+
 	// 建立 Fiber 應用程式
+	proxies := handlers.TrustedProxiesFromEnv()
 	app := fiber.New(fiber.Config{
 		// 配置代理頭，以便正確獲取真實客戶端IP
 		ProxyHeader: "X-Forwarded-For",
+		// 只取標頭中第一個有效的 IP，避免整個標頭被當作 IP 使用
+		EnableIPValidation: true,
+		// 設定 TRUSTED_PROXIES 後只接受來自代理伺服器的 X-Forwarded-For，避免客戶端偽造 IP
+		EnableTrustedProxyCheck: len(proxies) > 0,
+		TrustedProxies:          proxies,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -47,7 +61,8 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	}))
 
 	// 重定向路由 - 處理 /url/:short_code 格式
-	app.Get("/url/:short_code", handlers.RedirectURL)
+	app.Get("/url/:short_code/*", h.RedirectURL)
+	app.Post("/url/:short_code/*", h.UnlockURL)
 
 	// 處理請求
 	adaptor.FiberApp(app).ServeHTTP(w, r)
@@ -5,6 +5,7 @@ import (
 
 	"go-shorturl/pkg/db"
 	"go-shorturl/pkg/handlers"
+	"go-shorturl/pkg/shortcode"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -22,6 +23,14 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	store := db.NewPostgresStore(db.GetDB())
+	codes, err := shortcode.NewFromEnv(store)
+	if err != nil {
+		http.Error(w, "Invalid short code configuration", http.StatusInternalServerError)
+		return
+	}
+	h := handlers.New(store, handlers.WithCodeGenerator(codes))
+
 	// 建立 Fiber 應用程式
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -41,12 +50,13 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders: "Origin,Content-Type,Accept,Authorization,X-API-Key",
 	}))
 
 	// API 路由
-	api := app.Group("/api")
-	api.Post("/shorten", handlers.ShortenURL)
+	api := app.Group("/api", h.Authenticate)
+	api.Post("/shorten", h.ShortenURL)
+	api.Post("/shorten/bulk", h.BulkShortenURL)
 
 	// 處理請求
 	adaptor.FiberApp(app).ServeHTTP(w, r)
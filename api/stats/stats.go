@@ -22,6 +22,8 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	h := handlers.New(db.NewPostgresStore(db.GetDB()))
+
 	// 建立 Fiber 應用程式
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
@@ -41,13 +43,13 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders: "Origin,Content-Type,Accept,Authorization,X-API-Key",
 	}))
 
 	// API 路由
-	api := app.Group("/api")
-	api.Get("/stats/:short_code", handlers.GetStats)
-	api.Get("/clicks/:short_code", handlers.GetClickList)
+	api := app.Group("/api", h.Authenticate)
+	api.Get("/stats/:short_code", h.GetStats)
+	api.Get("/clicks/:short_code", h.GetClickList)
 
 	// 處理請求
 	adaptor.FiberApp(app).ServeHTTP(w, r)
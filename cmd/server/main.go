@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"go-shorturl/pkg/botdetect"
 	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/geo"
 	"go-shorturl/pkg/handlers"
+	"go-shorturl/pkg/ingest"
+	"go-shorturl/pkg/rollup"
+	"go-shorturl/pkg/shortcode"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -20,10 +29,59 @@ func main() {
 	}
 	defer db.CloseDB()
 
+	store := db.NewPostgresStore(db.GetDB())
+
+	// 短碼產生器（SHORT_CODE_STRATEGY、SHORT_CODE_ALPHABET、SHORT_CODE_MIN_LENGTH、SHORT_CODE_SECRET）
+	codes, err := shortcode.NewFromEnv(store)
+	if err != nil {
+		log.Fatalf("Invalid short code configuration: %v", err)
+	}
+
+	// IP 地理位置查詢（GEOIP_DB_PATH、GEOIP_IPAPI、GEOIP_LANGUAGE、GEOIP_RELOAD_INTERVAL）
+	resolver, closeGeo, err := geo.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid GeoIP configuration: %v", err)
+	}
+	defer closeGeo()
+
+	// 點擊處理管線（CLICK_QUEUE_SIZE、CLICK_WORKERS、CLICK_BATCH_SIZE、CLICK_FLUSH_INTERVAL）
+	clicks := ingest.NewPipeline(store, handlers.ClickEnricher(resolver), ingest.ConfigFromEnv())
+	clicks.Start()
+
+	// 點擊彙總（ROLLUP_INTERVAL、ROLLUP_DELAY）
+	rollups := rollup.NewAggregator(store, handlers.ClassifyClickGroup, rollup.ConfigFromEnv())
+	rollups.Start()
+
+	// 社交媒體爬蟲預覽頁面模板（PREVIEW_TEMPLATE_PATH，未設定時使用內建模板）
+	preview, err := handlers.LoadPreviewTemplate(os.Getenv("PREVIEW_TEMPLATE_PATH"))
+	if err != nil {
+		log.Fatalf("Invalid preview template: %v", err)
+	}
+
+	// 爬蟲判斷器（BOT_IP_RANGES_PATH 列出連結掃描程式的 IP 範圍，可選）
+	bots, err := botdetect.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid bot IP ranges: %v", err)
+	}
+
+	h := handlers.New(store,
+		handlers.WithCodeGenerator(codes),
+		handlers.WithClickQueue(clicks),
+		handlers.WithGeoResolver(resolver),
+		handlers.WithPreviewTemplate(preview),
+		handlers.WithBotDetector(bots),
+	)
+
 	// 建立 Fiber 應用程式
+	proxies := handlers.TrustedProxiesFromEnv()
 	app := fiber.New(fiber.Config{
 		// 配置代理頭，以便正確獲取真實客戶端IP
 		ProxyHeader: "X-Forwarded-For",
+		// 只取標頭中第一個有效的 IP，避免整個標頭被當作 IP 使用
+		EnableIPValidation: true,
+		// 設定 TRUSTED_PROXIES 後只接受來自代理伺服器的 X-Forwarded-For，避免客戶端偽造 IP
+		EnableTrustedProxyCheck: len(proxies) > 0,
+		TrustedProxies:          proxies,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -41,7 +99,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders: "Origin,Content-Type,Accept,Authorization,X-API-Key",
 	}))
 
 	// 提供靜態文件（前端構建後的文件）
@@ -49,16 +107,45 @@ func main() {
 	app.Static("/favicon.ico", "./frontend/dist/favicon.ico")
 
 	// API 路由
-	api := app.Group("/api")
-	api.Post("/shorten", handlers.ShortenURL)
-	api.Get("/stats/:short_code", handlers.GetStats)
-	api.Get("/clicks/:short_code", handlers.GetClickList)
+	api := app.Group("/api", h.Authenticate)
+	api.Post("/shorten", h.ShortenURL)
+	api.Post("/shorten/bulk", h.BulkShortenURL)
+	api.Get("/stats/:short_code", h.GetStats)
+	api.Get("/clicks/:short_code", h.GetClickList)
+
+	// 短網址管理
+	api.Get("/links", handlers.RequireAuth, h.ListLinks)
+	api.Get("/links/:short_code", h.GetLink)
+	api.Patch("/links/:short_code", h.UpdateLink)
+	api.Delete("/links/:short_code", h.DeleteLink)
+	api.Post("/links/:short_code/restore", h.RestoreLink)
+	api.Get("/links/:short_code/history", h.GetLinkHistory)
+	api.Post("/links/:short_code/preview/refresh", h.RefreshLinkPreview)
+
+	// 標籤及活動
+	api.Get("/tags", handlers.RequireAuth, h.ListTags)
+	api.Get("/tags/:tag/stats", handlers.RequireAuth, h.GetTagStats)
+	api.Get("/campaigns", handlers.RequireAuth, h.ListCampaigns)
+	api.Get("/campaigns/:campaign/stats", handlers.RequireAuth, h.GetCampaignStats)
+
+	// API 金鑰管理
+	api.Post("/keys", handlers.RequireAuth, h.CreateAPIKey)
+	api.Get("/keys", handlers.RequireAuth, h.ListAPIKeys)
+	api.Delete("/keys/:id", handlers.RequireAuth, h.RevokeAPIKey)
+
+	// 未匹配的 API 路徑返回 404，不交給最後的短網址路由
+	api.All("/*", func(c *fiber.Ctx) error {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	})
 
 	// 健康檢查端點
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
 			"status":  "ok",
 			"message": "Short URL service is running",
+			"clicks":  clicks.Stats(),
 		})
 	})
 
@@ -74,10 +161,26 @@ func main() {
 				"message": "Short URL Service",
 				"version": "1.0.0",
 				"endpoints": fiber.Map{
-					"POST /api/shorten":          "Create a short URL",
-					"GET /:short_code":           "Redirect to original URL",
-					"GET /api/stats/:short_code": "Get URL statistics",
-					"GET /health":                "Health check",
+					"POST /api/shorten":                           "Create a short URL",
+					"POST /api/shorten/bulk":                      "Create short URLs from a JSON array or CSV",
+					"GET /url/:short_code":                        "Redirect to original URL",
+					"POST /url/:short_code":                       "Unlock a password-protected link",
+					"GET /api/stats/:short_code":                  "Get URL statistics",
+					"GET /api/links":                              "List, search and paginate links",
+					"GET /api/links/:short_code":                  "Get link details",
+					"PATCH /api/links/:short_code":                "Update destination or enabled state",
+					"DELETE /api/links/:short_code":               "Soft delete a link",
+					"POST /api/links/:short_code/restore":         "Restore a deleted link",
+					"GET /api/links/:short_code/history":          "Get destination edit history",
+					"POST /api/links/:short_code/preview/refresh": "Refresh cached Open Graph preview",
+					"GET /api/tags":                               "List tags with link and click totals",
+					"GET /api/tags/:tag/stats":                    "Get tag totals and top links",
+					"GET /api/campaigns":                          "List campaigns with link and click totals",
+					"GET /api/campaigns/:campaign/stats":          "Get campaign totals and top links",
+					"POST /api/keys":                              "Create an API key",
+					"GET /api/keys":                               "List your API keys",
+					"DELETE /api/keys/:id":                        "Revoke an API key",
+					"GET /health":                                 "Health check",
 				},
 			})
 		}
@@ -85,8 +188,13 @@ func main() {
 	})
 
 	// 重定向路由 (必須放在最後，因為它會匹配所有路徑)
-	app.Get("/shorturl/:short_code", handlers.RedirectURL)
-	app.Get("/:short_code", handlers.RedirectURL) // 保持向後兼容
+	// 開啟路徑轉發的短網址也匹配短碼之後的路徑
+	app.Get("/url/:short_code/*", h.RedirectURL) // 短網址統一使用 /url/ 格式
+	app.Post("/url/:short_code/*", h.UnlockURL)
+	app.Get("/shorturl/:short_code/*", h.RedirectURL)
+	app.Post("/shorturl/:short_code/*", h.UnlockURL)
+	app.Get("/:short_code/*", h.RedirectURL) // 保持向後兼容
+	app.Post("/:short_code/*", h.UnlockURL)
 
 	// 啟動伺服器
 	port := os.Getenv("PORT")
@@ -94,6 +202,31 @@ func main() {
 		port = "8080"
 	}
 
+	// 收到終止信號時停止接收請求，並寫入佇列中剩餘的點擊
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+
+		log.Printf("Shutting down server...")
+		if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
 	log.Printf("Server starting on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+	listenErr := app.Listen(":" + port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := clicks.Close(ctx); err != nil {
+		log.Printf("Error flushing click queue: %v", err)
+	}
+	if err := rollups.Close(ctx); err != nil {
+		log.Printf("Error stopping click rollups: %v", err)
+	}
+
+	if listenErr != nil {
+		log.Fatal(listenErr)
+	}
 }
@@ -45,8 +45,261 @@ CREATE INDEX IF NOT EXISTS idx_clicks_location_region ON clicks(location_region)
 CREATE INDEX IF NOT EXISTS idx_clicks_location_city ON clicks(location_city);
 CREATE INDEX IF NOT EXISTS idx_clicks_location_isp ON clicks(location_isp);
 
--- 6. 验证表是否创建成功
+-- 6. 添加过期时间及点击次数上限字段
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS max_clicks INTEGER CHECK (max_clicks IS NULL OR max_clicks > 0);
+
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);
+
+-- 7. 添加启用状态、软删除字段及目标网址修改纪录表
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT TRUE,
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS url_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    url_id UUID REFERENCES urls(id) ON DELETE CASCADE,
+    original_url TEXT NOT NULL,
+    replaced_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_history_url_id ON url_history(url_id);
+
+-- 8. 创建 API 金钥表
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_urls_user_id ON urls(user_id);
+
+-- 9. 创建短码序号
+CREATE SEQUENCE IF NOT EXISTS short_code_seq START WITH 1;
+
+-- 10. 添加操作系统字段
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS os VARCHAR(50);
+
+-- 11. 创建短网址预览快取表
+CREATE TABLE IF NOT EXISTS link_previews (
+    url_id UUID PRIMARY KEY REFERENCES urls(id) ON DELETE CASCADE,
+    source_url TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image TEXT NOT NULL DEFAULT '',
+    type VARCHAR(50) NOT NULL DEFAULT '',
+    site_name TEXT NOT NULL DEFAULT '',
+    fetched_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- 12. 添加自订预览信息字段
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS og_title TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS og_description TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS og_image TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS twitter_card VARCHAR(30) NOT NULL DEFAULT '';
+
+-- 13. 添加重定向规则及点击命中规则字段
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_rules JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS target VARCHAR(100) NOT NULL DEFAULT '';
+
+-- 14. 添加 A/B 测试目标及点击分配目标字段
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS variant VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_clicks_url_id_variant ON clicks(url_id, variant) WHERE variant != '';
+
+-- 15. 添加访问密码及密码错误次数字段
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS failed_unlocks INTEGER NOT NULL DEFAULT 0;
+
+-- 16. 添加重定向状态码及查询参数传递方式字段
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS redirect_status SMALLINT NOT NULL DEFAULT 302 CHECK (redirect_status IN (301, 302, 307, 308)),
+ADD COLUMN IF NOT EXISTS query_passthrough VARCHAR(20) NOT NULL DEFAULT '';
+
+-- 17. 添加路径转发字段
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS path_forwarding BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 18. 添加开放时间及开放前目标网址字段
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS active_from TIMESTAMP,
+ADD COLUMN IF NOT EXISTS prelaunch_url TEXT NOT NULL DEFAULT '';
+
+-- 19. 添加短网址列表排序及搜索索引
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_urls_created_at_id ON urls(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_trgm ON urls USING GIN (original_url gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_urls_short_code_trgm ON urls USING GIN (short_code gin_trgm_ops);
+
+-- 20. 添加短网址标签及活动
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS campaign VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS url_tags (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    tag VARCHAR(50) NOT NULL,
+    PRIMARY KEY (url_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_tags_tag ON url_tags(tag);
+CREATE INDEX IF NOT EXISTS idx_urls_campaign ON urls(campaign) WHERE campaign != '';
+
+-- 21. 添加点击汇总表
+CREATE TABLE IF NOT EXISTS click_rollups_hourly (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    device_type TEXT NOT NULL DEFAULT '',
+    os TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    referrer_domain TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    clicks INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target)
+);
+
+CREATE TABLE IF NOT EXISTS click_rollups_daily (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    device_type TEXT NOT NULL DEFAULT '',
+    os TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    referrer_domain TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    clicks INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target)
+);
+
+-- 汇总进度：hourly_until 之前的点击已计入汇总
+CREATE TABLE IF NOT EXISTS click_rollup_state (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    hourly_until TIMESTAMP NOT NULL
+);
+
+INSERT INTO click_rollup_state (hourly_until)
+SELECT COALESCE(date_trunc('hour', MIN(clicked_at)), date_trunc('hour', NOW() AT TIME ZONE 'UTC'))
+FROM clicks
+ON CONFLICT (id) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_clicks_url_id_clicked_at ON clicks(url_id, clicked_at);
+
+-- 22. 添加访客指纹及不重复访客 sketch 表
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS visitor_hash BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS click_visitors_hourly (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    sketch BYTEA NOT NULL,
+    PRIMARY KEY (url_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS click_visitors_daily (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    sketch BYTEA NOT NULL,
+    PRIMARY KEY (url_id, bucket)
+);
+
+-- 23. 添加点击爬虫标记及汇总表爬虫维度
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS bot_name TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS bot_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_hourly DROP CONSTRAINT IF EXISTS click_rollups_hourly_pkey;
+ALTER TABLE click_rollups_hourly ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name);
+
+ALTER TABLE click_rollups_daily ADD COLUMN IF NOT EXISTS bot_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_daily DROP CONSTRAINT IF EXISTS click_rollups_daily_pkey;
+ALTER TABLE click_rollups_daily ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name);
+
+-- 24. 添加密码解锁尝试次数表
+CREATE TABLE IF NOT EXISTS unlock_attempts (
+    key TEXT PRIMARY KEY,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    window_start TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_unlock_attempts_window_start ON unlock_attempts(window_start);
+
+-- 25. 添加短网址累计点击数
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS click_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS bot_click_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE urls
+SET click_count = c.total, bot_click_count = c.bots
+FROM (
+    SELECT url_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE is_bot) AS bots
+    FROM clicks
+    GROUP BY url_id
+) c
+WHERE c.url_id = urls.id;
+
+CREATE INDEX IF NOT EXISTS idx_urls_human_clicks_id ON urls((click_count - bot_click_count), id);
+
+-- 26. 添加点击写入时间
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS inserted_at TIMESTAMP;
+UPDATE clicks SET inserted_at = COALESCE(clicked_at, NOW() AT TIME ZONE 'UTC') WHERE inserted_at IS NULL;
+ALTER TABLE clicks
+ALTER COLUMN inserted_at SET DEFAULT (NOW() AT TIME ZONE 'UTC'),
+ALTER COLUMN inserted_at SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_clicks_inserted_at ON clicks(inserted_at);
+
+-- 27. 添加汇总表及访客 sketch 的 A/B 测试目标维度
+-- 既有的汇总没有目标信息：首次添加字段时清空汇总并将汇总进度退回最早写入的点击，由后台程序重新汇总
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'click_rollups_hourly' AND column_name = 'variant'
+    ) THEN
+        TRUNCATE click_rollups_hourly, click_rollups_daily, click_visitors_hourly, click_visitors_daily;
+        UPDATE click_rollup_state
+        SET hourly_until = COALESCE(
+            (SELECT date_trunc('hour', MIN(inserted_at)) FROM clicks),
+            date_trunc('hour', NOW() AT TIME ZONE 'UTC')
+        );
+    END IF;
+END $$;
+
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_hourly DROP CONSTRAINT IF EXISTS click_rollups_hourly_pkey;
+ALTER TABLE click_rollups_hourly ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name, variant);
+
+ALTER TABLE click_rollups_daily ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_daily DROP CONSTRAINT IF EXISTS click_rollups_daily_pkey;
+ALTER TABLE click_rollups_daily ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name, variant);
+
+ALTER TABLE click_visitors_hourly ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_visitors_hourly DROP CONSTRAINT IF EXISTS click_visitors_hourly_pkey;
+ALTER TABLE click_visitors_hourly ADD PRIMARY KEY (url_id, bucket, variant);
+
+ALTER TABLE click_visitors_daily ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_visitors_daily DROP CONSTRAINT IF EXISTS click_visitors_daily_pkey;
+ALTER TABLE click_visitors_daily ADD PRIMARY KEY (url_id, bucket, variant);
+
+-- 28. 添加汇总表爬虫标记维度
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_rollups_daily ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE click_rollups_hourly SET is_bot = TRUE WHERE bot_name != '' AND NOT is_bot;
+UPDATE click_rollups_daily SET is_bot = TRUE WHERE bot_name != '' AND NOT is_bot;
+
+ALTER TABLE click_rollups_hourly DROP CONSTRAINT IF EXISTS click_rollups_hourly_pkey;
+ALTER TABLE click_rollups_hourly ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, is_bot, bot_name, variant);
+
+ALTER TABLE click_rollups_daily DROP CONSTRAINT IF EXISTS click_rollups_daily_pkey;
+ALTER TABLE click_rollups_daily ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, is_bot, bot_name, variant);
+
+-- 29. 验证表是否创建成功
 SELECT 'Tables created successfully!' as status;
 SELECT table_name FROM information_schema.tables 
-WHERE table_schema = 'public' AND table_name IN ('urls', 'clicks');
+WHERE table_schema = 'public' AND table_name IN ('urls', 'clicks', 'url_history', 'api_keys', 'link_previews', 'url_tags', 'click_rollups_hourly', 'click_rollups_daily', 'click_rollup_state', 'click_visitors_hourly', 'click_visitors_daily', 'unlock_attempts');
 
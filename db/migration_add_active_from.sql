@@ -0,0 +1,4 @@
+-- 短網址的開放時間（NULL 表示立即開放）及開放前的目標網址（空字串表示顯示倒數頁面）
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS active_from TIMESTAMP,
+ADD COLUMN IF NOT EXISTS prelaunch_url TEXT NOT NULL DEFAULT '';
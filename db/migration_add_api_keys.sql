@@ -0,0 +1,14 @@
+-- API 金鑰表（只保存金鑰的 SHA-256 雜湊值）
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    revoked_at TIMESTAMP
+);
+
+-- 建立索引以提升查詢效能
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX IF NOT EXISTS idx_urls_user_id ON urls(user_id);
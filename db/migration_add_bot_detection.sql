@@ -0,0 +1,13 @@
+-- 爬蟲過濾：點擊記錄是否來自爬蟲、無頭瀏覽器、預取或連結掃描程式，統計預設排除
+-- 升級前的點擊都視為一般訪客
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS bot_name TEXT NOT NULL DEFAULT '';
+
+-- 彙總表以爬蟲名稱作為維度（空字串表示一般訪客）
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS bot_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_hourly DROP CONSTRAINT IF EXISTS click_rollups_hourly_pkey;
+ALTER TABLE click_rollups_hourly ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name);
+
+ALTER TABLE click_rollups_daily ADD COLUMN IF NOT EXISTS bot_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_daily DROP CONSTRAINT IF EXISTS click_rollups_daily_pkey;
+ALTER TABLE click_rollups_daily ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name);
@@ -0,0 +1,17 @@
+-- 短網址的累計點擊數及其中爬蟲的點擊數，寫入點擊時一併更新，列表排序不需逐筆統計點擊記錄
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS click_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS bot_click_count INTEGER NOT NULL DEFAULT 0;
+
+-- 以現有的點擊記錄計算初始值
+UPDATE urls
+SET click_count = c.total, bot_click_count = c.bots
+FROM (
+    SELECT url_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE is_bot) AS bots
+    FROM clicks
+    GROUP BY url_id
+) c
+WHERE c.url_id = urls.id;
+
+-- 建立索引以提升依點擊數排序的效能
+CREATE INDEX IF NOT EXISTS idx_urls_human_clicks_id ON urls((click_count - bot_click_count), id);
@@ -0,0 +1,10 @@
+-- 點擊寫入時間：點擊彙總改以寫入時間推進進度，點擊佇列延遲寫入的較早點擊也會被彙總
+-- 既有的點擊以點擊時間作為寫入時間，與原本依點擊時間推進的彙總進度一致
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS inserted_at TIMESTAMP;
+UPDATE clicks SET inserted_at = COALESCE(clicked_at, NOW() AT TIME ZONE 'UTC') WHERE inserted_at IS NULL;
+ALTER TABLE clicks
+ALTER COLUMN inserted_at SET DEFAULT (NOW() AT TIME ZONE 'UTC'),
+ALTER COLUMN inserted_at SET NOT NULL;
+
+-- 建立索引以提升依寫入時間彙總的效能
+CREATE INDEX IF NOT EXISTS idx_clicks_inserted_at ON clicks(inserted_at);
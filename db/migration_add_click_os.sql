@@ -0,0 +1,2 @@
+-- 點擊記錄增加操作系統欄位，由背景點擊處理管線在寫入前解析
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS os VARCHAR(50);
@@ -0,0 +1,40 @@
+-- 點擊彙總：依短網址、時間段及統計維度累計點擊數，由背景彙總程序維護
+-- 每日彙總以 UTC 日期為單位
+CREATE TABLE IF NOT EXISTS click_rollups_hourly (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    device_type TEXT NOT NULL DEFAULT '',
+    os TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    referrer_domain TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    clicks INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target)
+);
+
+CREATE TABLE IF NOT EXISTS click_rollups_daily (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    device_type TEXT NOT NULL DEFAULT '',
+    os TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    referrer_domain TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    clicks INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target)
+);
+
+-- 彙總進度（只有一筆）：hourly_until 之前的點擊已計入彙總
+-- 從最早的點擊所在的小時開始，背景程序會逐步補齊既有的點擊
+CREATE TABLE IF NOT EXISTS click_rollup_state (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    hourly_until TIMESTAMP NOT NULL
+);
+
+INSERT INTO click_rollup_state (hourly_until)
+SELECT COALESCE(date_trunc('hour', MIN(clicked_at)), date_trunc('hour', NOW() AT TIME ZONE 'UTC'))
+FROM clicks
+ON CONFLICT (id) DO NOTHING;
+
+-- 統計查詢最近尚未彙總的點擊
+CREATE INDEX IF NOT EXISTS idx_clicks_url_id_clicked_at ON clicks(url_id, clicked_at);
@@ -0,0 +1,7 @@
+-- 添加短網址過期時間及點擊次數上限字段到urls表
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS max_clicks INTEGER CHECK (max_clicks IS NULL OR max_clicks > 0);
+
+-- 為過期時間建立索引，方便查詢即將過期的短網址
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);
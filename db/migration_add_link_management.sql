@@ -0,0 +1,15 @@
+-- 添加短網址啟用狀態及軟刪除字段到urls表
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT TRUE,
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+
+-- 目標網址修改紀錄表（保存被替換掉的舊目標網址）
+CREATE TABLE IF NOT EXISTS url_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    url_id UUID REFERENCES urls(id) ON DELETE CASCADE,
+    original_url TEXT NOT NULL,
+    replaced_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_history_url_id ON url_history(url_id);
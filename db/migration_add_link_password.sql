@@ -0,0 +1,4 @@
+-- 短網址的存取密碼（bcrypt 雜湊值，空字串表示不需要密碼）及密碼錯誤次數
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS failed_unlocks INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- 短網址預覽快取：社交媒體爬蟲訪問時抓取的目標網頁 Open Graph 信息
+CREATE TABLE IF NOT EXISTS link_previews (
+    url_id UUID PRIMARY KEY REFERENCES urls(id) ON DELETE CASCADE,
+    source_url TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image TEXT NOT NULL DEFAULT '',
+    type VARCHAR(50) NOT NULL DEFAULT '',
+    site_name TEXT NOT NULL DEFAULT '',
+    fetched_at TIMESTAMP NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+-- 短網址列表的分頁排序及目標網址、短碼搜尋（pg_trgm 支援 ILIKE '%...%'）
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_urls_created_at_id ON urls(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_trgm ON urls USING GIN (original_url gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_urls_short_code_trgm ON urls USING GIN (short_code gin_trgm_ops);
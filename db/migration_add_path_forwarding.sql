@@ -0,0 +1,2 @@
+-- 短網址是否將短碼之後的路徑附加到目標網址
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS path_forwarding BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+-- 短網址自訂社交媒體預覽信息，空字串表示使用從目標網頁抓取的內容
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS og_title TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS og_description TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS og_image TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS twitter_card VARCHAR(30) NOT NULL DEFAULT '';
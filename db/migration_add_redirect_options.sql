@@ -0,0 +1,4 @@
+-- 短網址的重定向狀態碼，以及訪客查詢參數傳遞到目標網址的方式（preserve、override，空字串表示不傳遞）
+ALTER TABLE urls
+ADD COLUMN IF NOT EXISTS redirect_status SMALLINT NOT NULL DEFAULT 302 CHECK (redirect_status IN (301, 302, 307, 308)),
+ADD COLUMN IF NOT EXISTS query_passthrough VARCHAR(20) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- 短網址依訪客設備及操作系統重定向的規則（JSON 陣列，依序評估），以及點擊命中的規則名稱
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_rules JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS target VARCHAR(100) NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- 彙總表以 is_bot 判斷爬蟲的點擊，與原始點擊的過濾條件一致（爬蟲名稱只用於分組顯示）
+-- 須在 migration_add_variant_rollups.sql 之後執行
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_rollups_daily ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 既有的彙總以爬蟲名稱標記爬蟲
+UPDATE click_rollups_hourly SET is_bot = TRUE WHERE bot_name != '' AND NOT is_bot;
+UPDATE click_rollups_daily SET is_bot = TRUE WHERE bot_name != '' AND NOT is_bot;
+
+ALTER TABLE click_rollups_hourly DROP CONSTRAINT IF EXISTS click_rollups_hourly_pkey;
+ALTER TABLE click_rollups_hourly ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, is_bot, bot_name, variant);
+
+ALTER TABLE click_rollups_daily DROP CONSTRAINT IF EXISTS click_rollups_daily_pkey;
+ALTER TABLE click_rollups_daily ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, is_bot, bot_name, variant);
@@ -0,0 +1,2 @@
+-- 短碼序號，自動產生的短碼由此序號編碼而成，避免先查詢再插入的競爭條件
+CREATE SEQUENCE IF NOT EXISTS short_code_seq START WITH 1;
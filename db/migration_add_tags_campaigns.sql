@@ -0,0 +1,11 @@
+-- 短網址標籤（多對多，標籤以名稱識別）及所屬活動（空字串表示未分組）
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS campaign VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS url_tags (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    tag VARCHAR(50) NOT NULL,
+    PRIMARY KEY (url_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_tags_tag ON url_tags(tag);
+CREATE INDEX IF NOT EXISTS idx_urls_campaign ON urls(campaign) WHERE campaign != '';
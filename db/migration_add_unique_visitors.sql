@@ -0,0 +1,17 @@
+-- 不重複訪客：點擊記錄訪客指紋（IP 及 User-Agent 的每日加鹽雜湊，0 表示未記錄），
+-- 彙總時依短網址及時間段保存 HyperLogLog sketch，跨時間段合併即可估算不重複訪客數
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS visitor_hash BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS click_visitors_hourly (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    sketch BYTEA NOT NULL,
+    PRIMARY KEY (url_id, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS click_visitors_daily (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    bucket TIMESTAMP NOT NULL,
+    sketch BYTEA NOT NULL,
+    PRIMARY KEY (url_id, bucket)
+);
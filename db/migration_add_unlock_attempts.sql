@@ -0,0 +1,9 @@
+-- 密碼解鎖嘗試次數（以短網址或短網址及 IP 為鍵），保存在資料庫讓多個實例及 Vercel 共用鎖定狀態
+CREATE TABLE IF NOT EXISTS unlock_attempts (
+    key TEXT PRIMARY KEY,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    window_start TIMESTAMP NOT NULL
+);
+
+-- 建立索引以清除過期記錄
+CREATE INDEX IF NOT EXISTS idx_unlock_attempts_window_start ON unlock_attempts(window_start);
@@ -0,0 +1,35 @@
+-- A/B 測試統計改讀彙總表：彙總表及訪客 sketch 以分配到的目標作為維度（空字串表示未參與分流）
+-- 須在 migration_add_click_inserted_at.sql 之後執行
+
+-- 既有的彙總沒有目標資訊：首次新增欄位時清空彙總並將彙總進度退回最早寫入的點擊，由背景程序重新彙總
+-- 重新彙總完成前，統計會從原始記錄查詢尚未彙總的點擊；重複執行時不會再次清空
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'click_rollups_hourly' AND column_name = 'variant'
+    ) THEN
+        TRUNCATE click_rollups_hourly, click_rollups_daily, click_visitors_hourly, click_visitors_daily;
+        UPDATE click_rollup_state
+        SET hourly_until = COALESCE(
+            (SELECT date_trunc('hour', MIN(inserted_at)) FROM clicks),
+            date_trunc('hour', NOW() AT TIME ZONE 'UTC')
+        );
+    END IF;
+END $$;
+
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_hourly DROP CONSTRAINT IF EXISTS click_rollups_hourly_pkey;
+ALTER TABLE click_rollups_hourly ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name, variant);
+
+ALTER TABLE click_rollups_daily ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_rollups_daily DROP CONSTRAINT IF EXISTS click_rollups_daily_pkey;
+ALTER TABLE click_rollups_daily ADD PRIMARY KEY (url_id, bucket, device_type, os, country, referrer_domain, target, bot_name, variant);
+
+ALTER TABLE click_visitors_hourly ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_visitors_hourly DROP CONSTRAINT IF EXISTS click_visitors_hourly_pkey;
+ALTER TABLE click_visitors_hourly ADD PRIMARY KEY (url_id, bucket, variant);
+
+ALTER TABLE click_visitors_daily ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+ALTER TABLE click_visitors_daily DROP CONSTRAINT IF EXISTS click_visitors_daily_pkey;
+ALTER TABLE click_visitors_daily ADD PRIMARY KEY (url_id, bucket, variant);
@@ -0,0 +1,5 @@
+-- 短網址的 A/B 測試目標網址（JSON 陣列，依權重分配流量），以及點擊分配到的目標名稱
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS variant VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_clicks_url_id_variant ON clicks(url_id, variant) WHERE variant != '';
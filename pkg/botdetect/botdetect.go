@@ -0,0 +1,235 @@
+// Package botdetect 判斷請求是否來自爬蟲、無頭瀏覽器、預取或連結掃描程式
+package botdetect
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Bot 判斷結果
+type Bot struct {
+	Name    string // 爬蟲名稱，例如 Googlebot、Facebook
+	Preview bool   // 是否為抓取連結預覽的社交媒體爬蟲（返回 Open Graph 頁面）
+}
+
+// Request 判斷所需的請求資訊
+type Request struct {
+	Method    string
+	UserAgent string
+	IP        string
+	Purpose   string // Sec-Purpose、Purpose、X-Purpose 或 X-Moz 標頭
+}
+
+// signature User-Agent 特徵（小寫子字串）
+type signature struct {
+	pattern string
+	bot     Bot
+}
+
+// previewBots 抓取連結預覽的社交媒體爬蟲
+var previewBots = []signature{
+	{"facebookexternalhit", Bot{Name: "Facebook", Preview: true}},
+	{"facebot", Bot{Name: "Facebook", Preview: true}},
+	{"telegrambot", Bot{Name: "Telegram", Preview: true}}, // 須在 twitterbot 之前："TelegramBot (like TwitterBot)"
+	{"twitterbot", Bot{Name: "Twitter", Preview: true}},
+	{"linkedinbot", Bot{Name: "LinkedIn", Preview: true}},
+	{"whatsapp", Bot{Name: "WhatsApp", Preview: true}},
+	{"slackbot", Bot{Name: "Slack", Preview: true}},
+	{"slack-imgproxy", Bot{Name: "Slack", Preview: true}},
+	{"discordbot", Bot{Name: "Discord", Preview: true}}, // 不可只比對 discord，桌面版的內建瀏覽器也帶有 discord/
+	{"skypeuripreview", Bot{Name: "Skype", Preview: true}},
+	{"pinterestbot", Bot{Name: "Pinterest", Preview: true}},
+	{"redditbot", Bot{Name: "Reddit", Preview: true}},
+	{"line-poker", Bot{Name: "LINE", Preview: true}},
+	{"embedly", Bot{Name: "Embedly", Preview: true}},
+	{"iframely", Bot{Name: "Iframely", Preview: true}},
+	{"vkshare", Bot{Name: "VK", Preview: true}},
+	{"mastodon", Bot{Name: "Mastodon", Preview: true}},
+}
+
+// crawlers 搜尋引擎、AI、SEO 爬蟲、監控服務及 HTTP 函式庫
+var crawlers = []signature{
+	{"googlebot", Bot{Name: "Googlebot"}},
+	{"google-inspectiontool", Bot{Name: "Googlebot"}},
+	{"adsbot-google", Bot{Name: "Google Ads"}},
+	{"mediapartners-google", Bot{Name: "Google AdSense"}},
+	{"google-read-aloud", Bot{Name: "Google Read Aloud"}},
+	{"bingbot", Bot{Name: "Bingbot"}},
+	{"bingpreview", Bot{Name: "Bing Preview"}},
+	{"yandex", Bot{Name: "Yandex"}},
+	{"baiduspider", Bot{Name: "Baidu"}},
+	{"duckduckbot", Bot{Name: "DuckDuckGo"}},
+	{"yahoo! slurp", Bot{Name: "Yahoo"}},
+	{"sogou", Bot{Name: "Sogou"}},
+	{"360spider", Bot{Name: "360"}},
+	{"bytespider", Bot{Name: "Bytespider"}},
+	{"petalbot", Bot{Name: "PetalBot"}},
+	{"applebot", Bot{Name: "Applebot"}},
+	{"gptbot", Bot{Name: "GPTBot"}},
+	{"chatgpt-user", Bot{Name: "ChatGPT"}},
+	{"claudebot", Bot{Name: "ClaudeBot"}},
+	{"perplexitybot", Bot{Name: "PerplexityBot"}},
+	{"ccbot", Bot{Name: "Common Crawl"}},
+	{"amazonbot", Bot{Name: "Amazonbot"}},
+	{"ia_archiver", Bot{Name: "Internet Archive"}},
+	{"archive.org_bot", Bot{Name: "Internet Archive"}},
+	{"ahrefsbot", Bot{Name: "AhrefsBot"}},
+	{"semrushbot", Bot{Name: "SemrushBot"}},
+	{"mj12bot", Bot{Name: "MJ12bot"}},
+	{"dotbot", Bot{Name: "DotBot"}},
+	{"uptimerobot", Bot{Name: "UptimeRobot"}},
+	{"pingdom", Bot{Name: "Pingdom"}},
+	{"statuscake", Bot{Name: "StatusCake"}},
+	{"curl/", Bot{Name: "curl"}},
+	{"wget/", Bot{Name: "Wget"}},
+	{"python-requests", Bot{Name: "Python"}},
+	{"python-urllib", Bot{Name: "Python"}},
+	{"aiohttp", Bot{Name: "Python"}},
+	{"go-http-client", Bot{Name: "Go"}},
+	{"okhttp", Bot{Name: "OkHttp"}},
+	{"apache-httpclient", Bot{Name: "Java"}},
+	{"java/", Bot{Name: "Java"}},
+	{"axios/", Bot{Name: "axios"}},
+	{"node-fetch", Bot{Name: "Node.js"}},
+	{"undici", Bot{Name: "Node.js"}},
+	{"libwww-perl", Bot{Name: "Perl"}},
+}
+
+// headlessBrowsers 無頭瀏覽器及自動化工具
+var headlessBrowsers = []signature{
+	{"headlesschrome", Bot{Name: "Headless Chrome"}},
+	{"phantomjs", Bot{Name: "PhantomJS"}},
+	{"slimerjs", Bot{Name: "SlimerJS"}},
+	{"htmlunit", Bot{Name: "HtmlUnit"}},
+	{"selenium", Bot{Name: "Selenium"}},
+	{"playwright", Bot{Name: "Playwright"}},
+	{"puppeteer", Bot{Name: "Puppeteer"}},
+	{"chrome-lighthouse", Bot{Name: "Lighthouse"}},
+}
+
+// genericPatterns 未列出的爬蟲常見的 User-Agent 特徵
+// 不包括 +http：一般瀏覽器及應用程式的 User-Agent 也可能附帶聯絡網址
+var genericPatterns = []string{"crawler", "spider", "bot/", "bot;"}
+
+// IPRange 連結掃描程式（例如郵件安全閘道）使用的 IP 範圍
+type IPRange struct {
+	Network *net.IPNet
+	Name    string
+}
+
+// Detector 爬蟲判斷器，零值只依 User-Agent 及請求方式判斷
+type Detector struct {
+	ranges []IPRange
+}
+
+// New 以連結掃描程式的 IP 範圍建立判斷器
+func New(ranges []IPRange) *Detector {
+	return &Detector{ranges: ranges}
+}
+
+// NewFromEnv 以 BOT_IP_RANGES_PATH（可選）列出的連結掃描程式 IP 範圍建立判斷器
+func NewFromEnv() (*Detector, error) {
+	ranges, err := LoadIPRanges(os.Getenv("BOT_IP_RANGES_PATH"))
+	if err != nil {
+		return nil, fmt.Errorf("BOT_IP_RANGES_PATH: %w", err)
+	}
+	return New(ranges), nil
+}
+
+// Detect 判斷請求是否來自爬蟲，依序檢查 User-Agent、IP 範圍及請求方式
+func (d *Detector) Detect(r Request) (Bot, bool) {
+	ua := strings.ToLower(r.UserAgent)
+	for _, list := range [][]signature{previewBots, crawlers, headlessBrowsers} {
+		for _, sig := range list {
+			if strings.Contains(ua, sig.pattern) {
+				return sig.bot, true
+			}
+		}
+	}
+	for _, pattern := range genericPatterns {
+		if strings.Contains(ua, pattern) {
+			return Bot{Name: "Other"}, true
+		}
+	}
+
+	if d != nil && len(d.ranges) > 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.IP)); ip != nil {
+			for _, ipRange := range d.ranges {
+				if ipRange.Network.Contains(ip) {
+					return Bot{Name: ipRange.Name}, true
+				}
+			}
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		return Bot{Name: "HEAD"}, true
+	}
+	purpose := strings.ToLower(r.Purpose)
+	if strings.Contains(purpose, "prefetch") || strings.Contains(purpose, "prerender") || strings.Contains(purpose, "preview") {
+		return Bot{Name: "Prefetch"}, true
+	}
+	return Bot{}, false
+}
+
+// LoadIPRanges 讀取 IP 範圍檔案，路徑為空時返回 nil
+func LoadIPRanges(path string) ([]IPRange, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseIPRanges(f)
+}
+
+// ParseIPRanges 解析 IP 範圍：每行一個 CIDR 或 IP，之後可接名稱（預設 Link scanner），# 之後為註解
+func ParseIPRanges(r io.Reader) ([]IPRange, error) {
+	var ranges []IPRange
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		network, err := parseNetwork(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		name := strings.Join(fields[1:], " ")
+		if name == "" {
+			name = "Link scanner"
+		}
+		ranges = append(ranges, IPRange{Network: network, Name: name})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// parseNetwork 解析 CIDR，單一 IP 視為 /32 或 /128
+func parseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		return network, err
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP range %q", value)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
@@ -0,0 +1,145 @@
+package botdetect
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	chromeUA  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	safariUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36"
+)
+
+func TestDetectUserAgents(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		bot       string // 空字串表示一般訪客
+		preview   bool
+	}{
+		{"chrome", chromeUA, "", false},
+		{"safari", safariUA, "", false},
+		{"android chrome", androidUA, "", false},
+		{"firefox", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.1; rv:121.0) Gecko/20100101 Firefox/121.0", "", false},
+		{"discord in-app browser", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) discord/1.0.9013 Chrome/108.0.5359.215 Electron/22.3.2 Safari/537.36", "", false},
+		{"facebook in-app browser", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/442.0.0.36.110;FBBV/540127383]", "", false},
+		{"instagram in-app browser", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Instagram 311.0.2.29.109", "", false},
+		{"line in-app browser", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Safari Line/13.21.0", "", false},
+		{"slack desktop", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Slack/4.35.131 Chrome/118.0.5993.120 Electron/27.0.2 Safari/537.36", "", false},
+		{"contact url", chromeUA + " MyCompanyApp/2.0 (+https://example.com/contact)", "", false},
+
+		{"googlebot", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Googlebot", false},
+		{"bingbot", "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", "Bingbot", false},
+		{"gptbot", "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.0; +https://openai.com/gptbot)", "GPTBot", false},
+		{"ahrefs", "Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", "AhrefsBot", false},
+		{"uptimerobot", "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", "UptimeRobot", false},
+		{"curl", "curl/8.4.0", "curl", false},
+		{"python", "python-requests/2.31.0", "Python", false},
+		{"go", "Go-http-client/1.1", "Go", false},
+		{"headless chrome", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", "Headless Chrome", false},
+		{"generic crawler", "ExampleCrawler/1.0", "Other", false},
+		{"generic bot", "Mozilla/5.0 (compatible; ExampleBot/1.0)", "Other", false},
+
+		{"facebook preview", "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", "Facebook", true},
+		{"twitter preview", "Twitterbot/1.0", "Twitter", true},
+		{"discord preview", "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", "Discord", true},
+		{"slack preview", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", "Slack", true},
+		{"telegram preview", "TelegramBot (like TwitterBot)", "Telegram", true},
+	}
+	var detector *Detector
+	for _, tt := range tests {
+		bot, ok := detector.Detect(Request{Method: http.MethodGet, UserAgent: tt.userAgent})
+		if ok != (tt.bot != "") || bot.Name != tt.bot || bot.Preview != tt.preview {
+			t.Errorf("%s: Detect = %+v, %v; want %q (preview %v)", tt.name, bot, ok, tt.bot, tt.preview)
+		}
+	}
+}
+
+func TestDetectRequestMethodAndPurpose(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		bot  string
+	}{
+		{"get", Request{Method: http.MethodGet, UserAgent: chromeUA}, ""},
+		{"head", Request{Method: http.MethodHead, UserAgent: chromeUA}, "HEAD"},
+		{"prefetch", Request{Method: http.MethodGet, UserAgent: chromeUA, Purpose: "prefetch"}, "Prefetch"},
+		{"prefetch prerender", Request{Method: http.MethodGet, UserAgent: chromeUA, Purpose: "prefetch;prerender"}, "Prefetch"},
+		{"safari preview", Request{Method: http.MethodGet, UserAgent: safariUA, Purpose: "preview"}, "Prefetch"},
+		{"other purpose", Request{Method: http.MethodGet, UserAgent: chromeUA, Purpose: "navigate"}, ""},
+	}
+	detector := New(nil)
+	for _, tt := range tests {
+		bot, ok := detector.Detect(tt.req)
+		if ok != (tt.bot != "") || bot.Name != tt.bot {
+			t.Errorf("%s: Detect = %+v, %v; want %q", tt.name, bot, ok, tt.bot)
+		}
+	}
+}
+
+func TestNewFromEnvIPRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.txt")
+	content := strings.Join([]string{
+		"# Mail security gateway",
+		"203.0.113.0/24 Mail scanner",
+		"198.51.100.7",
+		"2001:db8::/32 IPv6 scanner # trailing comment",
+		"",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BOT_IP_RANGES_PATH", path)
+
+	detector, err := NewFromEnv()
+	if err != nil {
+		t.Fatalf("NewFromEnv: %v", err)
+	}
+
+	tests := []struct {
+		ip  string
+		bot string
+	}{
+		{"203.0.113.25", "Mail scanner"},
+		{"198.51.100.7", "Link scanner"},
+		{"198.51.100.8", ""},
+		{"2001:db8::1", "IPv6 scanner"},
+		{"192.0.2.1", ""},
+		{"not an ip", ""},
+	}
+	for _, tt := range tests {
+		bot, ok := detector.Detect(Request{Method: http.MethodGet, UserAgent: chromeUA, IP: tt.ip})
+		if ok != (tt.bot != "") || bot.Name != tt.bot {
+			t.Errorf("IP %s: Detect = %+v, %v; want %q", tt.ip, bot, ok, tt.bot)
+		}
+	}
+}
+
+func TestNewFromEnvErrors(t *testing.T) {
+	t.Setenv("BOT_IP_RANGES_PATH", "")
+	detector, err := NewFromEnv()
+	if err != nil {
+		t.Fatalf("NewFromEnv without path: %v", err)
+	}
+	if _, ok := detector.Detect(Request{Method: http.MethodGet, UserAgent: chromeUA, IP: "203.0.113.25"}); ok {
+		t.Error("detector without IP ranges flagged a browser")
+	}
+
+	t.Setenv("BOT_IP_RANGES_PATH", filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("NewFromEnv with missing file succeeded, want error")
+	}
+
+	path := filepath.Join(t.TempDir(), "invalid.txt")
+	if err := os.WriteFile(path, []byte("203.0.113.0/24\nnot-a-range\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BOT_IP_RANGES_PATH", path)
+	if _, err := NewFromEnv(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("NewFromEnv with invalid file = %v, want line 2 error", err)
+	}
+}
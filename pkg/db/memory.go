@@ -0,0 +1,968 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-shorturl/pkg/hll"
+	"go-shorturl/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore 以記憶體實作的 Store，適用於單元測試與本地開發
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sequence atomic.Uint64
+	urls     map[string]*models.URL // 以短碼為鍵
+	clicks   map[uuid.UUID][]models.Click
+	history  map[uuid.UUID][]models.URLHistory
+	apiKeys  map[uuid.UUID]*models.APIKey
+	previews map[uuid.UUID]*models.LinkPreview
+	unlocks  map[string]*unlockAttempts
+
+	// 點擊彙總，rollupUntil 之前的點擊已計入
+	hourlyRollups  map[rollupKey]int
+	dailyRollups   map[rollupKey]int
+	hourlyVisitors map[visitorKey]*hll.Sketch
+	dailyVisitors  map[visitorKey]*hll.Sketch
+	rollupUntil    time.Time
+}
+
+// unlockAttempts 一段時間內的解鎖嘗試次數
+type unlockAttempts struct {
+	attempts    int
+	windowStart time.Time
+}
+
+// rollupKey 彙總記錄的唯一鍵
+type rollupKey struct {
+	urlID  uuid.UUID
+	bucket int64 // Unix 秒
+	ClickDimensions
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore 建立空的 MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		urls:     make(map[string]*models.URL),
+		clicks:   make(map[uuid.UUID][]models.Click),
+		history:  make(map[uuid.UUID][]models.URLHistory),
+		apiKeys:  make(map[uuid.UUID]*models.APIKey),
+		previews: make(map[uuid.UUID]*models.LinkPreview),
+		unlocks:  make(map[string]*unlockAttempts),
+
+		hourlyRollups:  make(map[rollupKey]int),
+		dailyRollups:   make(map[rollupKey]int),
+		hourlyVisitors: make(map[visitorKey]*hll.Sketch),
+		dailyVisitors:  make(map[visitorKey]*hll.Sketch),
+		rollupUntil:    time.Now().UTC().Truncate(time.Hour),
+	}
+}
+
+// NextSequence 取得下一個短碼序號
+func (s *MemoryStore) NextSequence(ctx context.Context) (uint64, error) {
+	return s.sequence.Add(1), nil
+}
+
+// CreateURL 建立短網址
+func (s *MemoryStore) CreateURL(ctx context.Context, u *models.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.urls[u.ShortCode]; ok {
+		return ErrShortCodeExists
+	}
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+
+	stored := cloneURL(u)
+	stored.PasswordProtected = stored.PasswordHash != ""
+	s.urls[u.ShortCode] = stored
+	return nil
+}
+
+// CreateURLs 建立多個短網址，任一短碼重複時全部不寫入
+func (s *MemoryStore) CreateURLs(ctx context.Context, urls []*models.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := make(map[string]bool, len(urls))
+	for i, u := range urls {
+		if _, ok := s.urls[u.ShortCode]; ok || codes[u.ShortCode] {
+			return &BatchError{Index: i, Err: ErrShortCodeExists}
+		}
+		codes[u.ShortCode] = true
+	}
+
+	for _, u := range urls {
+		if u.ID == uuid.Nil {
+			u.ID = uuid.New()
+		}
+		if u.CreatedAt.IsZero() {
+			u.CreatedAt = time.Now()
+		}
+		stored := cloneURL(u)
+		stored.PasswordProtected = stored.PasswordHash != ""
+		s.urls[u.ShortCode] = stored
+	}
+	return nil
+}
+
+// GetURLByShortCode 依短碼查詢短網址
+func (s *MemoryStore) GetURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.urls[shortCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneURL(u), nil
+}
+
+// cloneURL 深複製短網址（包括指標及切片欄位），避免呼叫者與儲存的資料互相影響
+func cloneURL(u *models.URL) *models.URL {
+	c := *u
+	c.UserID = clonePtr(u.UserID)
+	c.ExpiresAt = clonePtr(u.ExpiresAt)
+	c.MaxClicks = clonePtr(u.MaxClicks)
+	c.DeletedAt = clonePtr(u.DeletedAt)
+	c.UpdatedAt = clonePtr(u.UpdatedAt)
+	c.ActiveFrom = clonePtr(u.ActiveFrom)
+	c.Tags = slices.Clone(u.Tags)
+	c.Variants = slices.Clone(u.Variants)
+	c.Rules = slices.Clone(u.Rules)
+	for i := range c.Rules {
+		c.Rules[i].Countries = slices.Clone(c.Rules[i].Countries)
+	}
+	return &c
+}
+
+// clonePtr 複製指標指向的值，nil 仍返回 nil
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// UpdateURL 修改短網址
+func (s *MemoryStore) UpdateURL(ctx context.Context, shortCode string, update URLUpdate) (*models.URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.urls[shortCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	if update.OriginalURL != nil && *update.OriginalURL != u.OriginalURL {
+		s.history[u.ID] = append(s.history[u.ID], models.URLHistory{
+			ID:          uuid.New(),
+			URLID:       u.ID,
+			OriginalURL: u.OriginalURL,
+			ReplacedAt:  now,
+		})
+		u.OriginalURL = *update.OriginalURL
+	}
+	if update.Enabled != nil {
+		u.Enabled = *update.Enabled
+	}
+	if update.OGTitle != nil {
+		u.OGTitle = *update.OGTitle
+	}
+	if update.OGDescription != nil {
+		u.OGDescription = *update.OGDescription
+	}
+	if update.OGImage != nil {
+		u.OGImage = *update.OGImage
+	}
+	if update.TwitterCard != nil {
+		u.TwitterCard = *update.TwitterCard
+	}
+	if update.Rules != nil {
+		u.Rules = cloneURL(&models.URL{Rules: *update.Rules}).Rules
+	}
+	if update.Variants != nil {
+		u.Variants = slices.Clone(*update.Variants)
+	}
+	if update.PasswordHash != nil {
+		u.PasswordHash = *update.PasswordHash
+		u.PasswordProtected = u.PasswordHash != ""
+	}
+	if update.RedirectStatus != nil {
+		u.RedirectStatus = *update.RedirectStatus
+	}
+	if update.QueryPassthrough != nil {
+		u.QueryPassthrough = *update.QueryPassthrough
+	}
+	if update.PathForwarding != nil {
+		u.PathForwarding = *update.PathForwarding
+	}
+	if update.ActiveFrom != nil {
+		u.ActiveFrom = clonePtr(*update.ActiveFrom)
+	}
+	if update.ExpiresAt != nil {
+		u.ExpiresAt = clonePtr(*update.ExpiresAt)
+	}
+	if update.MaxClicks != nil {
+		u.MaxClicks = clonePtr(*update.MaxClicks)
+	}
+	if update.PrelaunchURL != nil {
+		u.PrelaunchURL = *update.PrelaunchURL
+	}
+	if update.Tags != nil {
+		u.Tags = slices.Clone(*update.Tags)
+	}
+	if update.Campaign != nil {
+		u.Campaign = *update.Campaign
+	}
+	u.UpdatedAt = &now
+
+	return cloneURL(u), nil
+}
+
+// SetURLDeleted 軟刪除或還原短網址
+func (s *MemoryStore) SetURLDeleted(ctx context.Context, shortCode string, deleted bool) (*models.URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.urls[shortCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	u.DeletedAt = nil
+	if deleted {
+		deletedAt := now
+		u.DeletedAt = &deletedAt
+	}
+	u.UpdatedAt = &now
+
+	return cloneURL(u), nil
+}
+
+// RecordFailedUnlock 累計一次密碼錯誤
+func (s *MemoryStore) RecordFailedUnlock(ctx context.Context, urlID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.urls {
+		if u.ID == urlID {
+			u.FailedUnlocks++
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// AddUnlockAttempts 累計解鎖嘗試次數
+func (s *MemoryStore) AddUnlockAttempts(ctx context.Context, key string, n int, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.unlocks[key]
+	if !ok || a.windowStart.Before(since) {
+		a = &unlockAttempts{windowStart: time.Now().UTC()}
+		s.unlocks[key] = a
+	}
+	a.attempts = max(a.attempts+n, 0)
+	return a.attempts, nil
+}
+
+// ResetUnlockAttempts 清除解鎖嘗試次數及過期記錄
+func (s *MemoryStore) ResetUnlockAttempts(ctx context.Context, key string, since time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.unlocks, key)
+	for k, a := range s.unlocks {
+		if a.windowStart.Before(since) {
+			delete(s.unlocks, k)
+		}
+	}
+	return nil
+}
+
+// urlStatusMatches 檢查短網址是否符合狀態篩選，totalClicks 為包含爬蟲的所有點擊數
+func urlStatusMatches(u *models.URL, totalClicks int, status string, now time.Time) bool {
+	if status == URLStatusDeleted {
+		return u.DeletedAt != nil
+	}
+	if u.DeletedAt != nil {
+		return false
+	}
+
+	expired := (u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)) || (u.MaxClicks != nil && totalClicks >= *u.MaxClicks)
+	scheduled := u.ActiveFrom != nil && now.Before(*u.ActiveFrom)
+	switch status {
+	case "":
+		return true
+	case URLStatusDisabled:
+		return !u.Enabled
+	case URLStatusExpired:
+		return expired
+	case URLStatusScheduled:
+		return scheduled
+	case URLStatusActive:
+		return u.Enabled && !expired && !scheduled
+	}
+	return false
+}
+
+// urlDomainMatches 檢查目標網址的主機名稱是否為 domain 或其子網域
+func urlDomainMatches(originalURL, domain string) bool {
+	parsed, err := url.Parse(originalURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// filterURLs 依篩選條件（不含游標）取得短網址及其總點擊數，呼叫者需持有讀鎖
+func (s *MemoryStore) filterURLs(filter URLFilter) ([]models.LinkSummary, error) {
+	switch filter.Status {
+	case "", URLStatusActive, URLStatusDisabled, URLStatusExpired, URLStatusScheduled, URLStatusDeleted:
+	default:
+		return nil, fmt.Errorf("unknown status filter %q", filter.Status)
+	}
+
+	now := time.Now()
+	search := strings.ToLower(filter.Search)
+	var links []models.LinkSummary
+	for _, u := range s.urls {
+		if !urlStatusMatches(u, len(s.clicks[u.ID]), filter.Status, now) {
+			continue
+		}
+		if filter.UserID != nil && (u.UserID == nil || *u.UserID != *filter.UserID) {
+			continue
+		}
+		if filter.Domain != "" && !urlDomainMatches(u.OriginalURL, filter.Domain) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(u.OriginalURL), search) &&
+			!strings.Contains(strings.ToLower(u.ShortCode), search) {
+			continue
+		}
+		if filter.Tag != "" && !slices.Contains(u.Tags, filter.Tag) {
+			continue
+		}
+		if filter.Campaign != "" && u.Campaign != filter.Campaign {
+			continue
+		}
+		links = append(links, models.LinkSummary{URL: *cloneURL(u), TotalClicks: s.countHumanClicks(u.ID)})
+	}
+	return links, nil
+}
+
+// ListURLs 依條件列出短網址及其總點擊數
+func (s *MemoryStore) ListURLs(ctx context.Context, filter URLFilter) ([]models.LinkSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links, err := s.filterURLs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// 依 (排序值, id) 比較，與 PostgresStore 的游標條件一致
+	compare := func(link models.LinkSummary, cursor URLCursor) int {
+		var c int
+		if filter.Sort == URLSortClicks {
+			c = link.TotalClicks - cursor.Clicks
+		} else {
+			c = link.CreatedAt.Compare(cursor.CreatedAt)
+		}
+		if c == 0 {
+			c = strings.Compare(link.ID.String(), cursor.ID.String())
+		}
+		if !filter.Asc {
+			c = -c
+		}
+		return c
+	}
+	cursorOf := func(link models.LinkSummary) URLCursor {
+		return URLCursor{CreatedAt: link.CreatedAt, Clicks: link.TotalClicks, ID: link.ID}
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return compare(links[i], cursorOf(links[j])) < 0
+	})
+	if filter.After != nil {
+		start := sort.Search(len(links), func(i int) bool {
+			return compare(links[i], *filter.After) > 0
+		})
+		links = links[start:]
+	}
+	if len(links) > filter.Limit {
+		links = links[:filter.Limit]
+	}
+	return links, nil
+}
+
+// ListURLGroups 依標籤或活動分組統計短網址數及總點擊數
+func (s *MemoryStore) ListURLGroups(ctx context.Context, filter URLFilter, by string) ([]models.GroupStat, error) {
+	if by != URLGroupTag && by != URLGroupCampaign {
+		return nil, fmt.Errorf("unknown grouping %q", by)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links, err := s.filterURLs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*models.GroupStat)
+	add := func(name string, link models.LinkSummary) {
+		group, ok := groups[name]
+		if !ok {
+			group = &models.GroupStat{Name: name}
+			groups[name] = group
+		}
+		group.TotalLinks++
+		group.TotalClicks += link.TotalClicks
+	}
+	for _, link := range links {
+		if by == URLGroupTag {
+			for _, tag := range link.Tags {
+				add(tag, link)
+			}
+		} else if link.Campaign != "" {
+			add(link.Campaign, link)
+		}
+	}
+
+	var stats []models.GroupStat
+	for _, group := range groups {
+		stats = append(stats, *group)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalClicks != stats[j].TotalClicks {
+			return stats[i].TotalClicks > stats[j].TotalClicks
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats, nil
+}
+
+// ListURLHistory 取得目標網址修改紀錄
+func (s *MemoryStore) ListURLHistory(ctx context.Context, urlID uuid.UUID) ([]models.URLHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var history []models.URLHistory
+	entries := s.history[urlID]
+	for i := len(entries) - 1; i >= 0; i-- {
+		history = append(history, entries[i])
+	}
+	return history, nil
+}
+
+// GetLinkPreview 取得快取的 Open Graph 信息
+func (s *MemoryStore) GetLinkPreview(ctx context.Context, urlID uuid.UUID) (*models.LinkPreview, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	preview, ok := s.previews[urlID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *preview
+	return &found, nil
+}
+
+// SaveLinkPreview 儲存（覆蓋）Open Graph 信息
+func (s *MemoryStore) SaveLinkPreview(ctx context.Context, preview *models.LinkPreview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *preview
+	s.previews[preview.URLID] = &saved
+	return nil
+}
+
+// CreateAPIKey 建立 API 金鑰
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.ID == uuid.Nil {
+		key.ID = uuid.New()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+
+	stored := *key
+	s.apiKeys[key.ID] = &stored
+	return nil
+}
+
+// GetAPIKey 依 ID 查詢 API 金鑰
+func (s *MemoryStore) GetAPIKey(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *key
+	return &found, nil
+}
+
+// GetAPIKeyByHash 依雜湊值查詢 API 金鑰
+func (s *MemoryStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.apiKeys {
+		if key.KeyHash == keyHash {
+			found := *key
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListAPIKeys 取得使用者的所有 API 金鑰，userID 為 nil 時返回所有金鑰
+func (s *MemoryStore) ListAPIKeys(ctx context.Context, userID *uuid.UUID) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []models.APIKey
+	for _, key := range s.apiKeys {
+		if userID == nil || key.UserID == *userID {
+			keys = append(keys, *key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey 撤銷 API 金鑰
+func (s *MemoryStore) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+	}
+	return nil
+}
+
+// RecordClick 記錄一次點擊
+func (s *MemoryStore) RecordClick(ctx context.Context, click *models.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if click.ID == uuid.Nil {
+		click.ID = uuid.New()
+	}
+	if click.ClickedAt.IsZero() {
+		click.ClickedAt = time.Now()
+	}
+	click.InsertedAt = time.Now().UTC()
+	s.clicks[click.URLID] = append(s.clicks[click.URLID], *click)
+	return nil
+}
+
+// RecordClicks 批次記錄點擊
+func (s *MemoryStore) RecordClicks(ctx context.Context, clicks []models.Click) error {
+	for i := range clicks {
+		if err := s.RecordClick(ctx, &clicks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListClicks 取得 [from, to) 內最近的 limit 筆點擊（新到舊）
+func (s *MemoryStore) ListClicks(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.Click, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var clicks []models.Click
+	for _, click := range s.clicks[urlID] {
+		if inRange(click.ClickedAt, from, to) && (includeBots || !click.IsBot) {
+			clicks = append(clicks, click)
+		}
+	}
+	sort.SliceStable(clicks, func(i, j int) bool {
+		return clicks[i].ClickedAt.After(clicks[j].ClickedAt)
+	})
+	if len(clicks) > limit {
+		clicks = clicks[:limit]
+	}
+	return clicks, nil
+}
+
+// inRange 判斷時間是否在 [from, to) 內，to 為零值表示不限
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && (to.IsZero() || t.Before(to))
+}
+
+// contains 檢查點擊是否在查詢範圍內
+func (scope ClickScope) contains(click *models.Click) bool {
+	if scope.URLID != nil && click.URLID != *scope.URLID {
+		return false
+	}
+	if !scope.InsertedFrom.IsZero() && click.InsertedAt.Before(scope.InsertedFrom) {
+		return false
+	}
+	if !scope.InsertedUntil.IsZero() && !click.InsertedAt.Before(scope.InsertedUntil) {
+		return false
+	}
+	return inRange(click.ClickedAt, scope.From, scope.To)
+}
+
+// CountClicks 計算總點擊數（包含爬蟲）
+func (s *MemoryStore) CountClicks(ctx context.Context, urlID uuid.UUID) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.clicks[urlID]), nil
+}
+
+// countHumanClicks 計算不含爬蟲的總點擊數，呼叫者需持有讀鎖
+func (s *MemoryStore) countHumanClicks(urlID uuid.UUID) int {
+	total := 0
+	for _, click := range s.clicks[urlID] {
+		if !click.IsBot {
+			total++
+		}
+	}
+	return total
+}
+
+// countBy 依 key 分組計數 [from, to) 內的點擊，key 返回空字串的點擊不計入
+func (s *MemoryStore) countBy(urlID uuid.UUID, from, to time.Time, includeBots bool, key func(models.Click) string) []keyCount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	var order []string
+	for _, click := range s.clicks[urlID] {
+		if !inRange(click.ClickedAt, from, to) || (click.IsBot && !includeBots) {
+			continue
+		}
+		k := key(click)
+		if k == "" {
+			continue
+		}
+		if _, ok := counts[k]; !ok {
+			order = append(order, k)
+		}
+		counts[k]++
+	}
+
+	result := make([]keyCount, 0, len(order))
+	for _, k := range order {
+		result = append(result, keyCount{Key: k, Count: counts[k]})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// keyCount 分組計數結果
+type keyCount struct {
+	Key   string
+	Count int
+}
+
+// limitCounts 截取前 limit 筆
+func limitCounts(counts []keyCount, limit int) []keyCount {
+	if limit > 0 && len(counts) > limit {
+		return counts[:limit]
+	}
+	return counts
+}
+
+// UserAgentStats 依 User-Agent 分組統計
+func (s *MemoryStore) UserAgentStats(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.DeviceStat, error) {
+	var stats []models.DeviceStat
+	for _, kc := range limitCounts(s.countBy(urlID, from, to, includeBots, func(c models.Click) string { return c.UserAgent }), limit) {
+		stats = append(stats, models.DeviceStat{UserAgent: kc.Key, Count: kc.Count})
+	}
+	return stats, nil
+}
+
+// IPStats 依 IP 地址分組統計
+func (s *MemoryStore) IPStats(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.IPStat, error) {
+	var stats []models.IPStat
+	for _, kc := range limitCounts(s.countBy(urlID, from, to, includeBots, func(c models.Click) string { return c.IPAddress }), limit) {
+		stats = append(stats, models.IPStat{IPAddress: kc.Key, Count: kc.Count})
+	}
+	return stats, nil
+}
+
+// referrerDomain 取得來源網址的小寫主機名稱
+func referrerDomain(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || u.Scheme == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// ClickGroups 依小時及彙總維度分組原始點擊，已記錄設備類型及操作系統的點擊不附帶 User-Agent
+func (s *MemoryStore) ClickGroups(ctx context.Context, scope ClickScope) ([]ClickGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type groupKey struct {
+		rollupKey
+		userAgent string
+	}
+	counts := make(map[groupKey]int)
+	var order []groupKey
+	for id, clicks := range s.clicks {
+		for _, click := range clicks {
+			if !scope.contains(&click) {
+				continue
+			}
+			key := groupKey{rollupKey: rollupKey{
+				urlID:  id,
+				bucket: click.ClickedAt.Truncate(time.Hour).Unix(),
+				ClickDimensions: ClickDimensions{
+					DeviceType:     click.DeviceType,
+					OS:             click.OS,
+					Country:        click.LocationCountry,
+					ReferrerDomain: referrerDomain(click.Referrer),
+					Target:         click.Target,
+					IsBot:          click.IsBot,
+					BotName:        click.BotName,
+					Variant:        click.Variant,
+				},
+			}}
+			if click.DeviceType == "" || click.OS == "" {
+				key.userAgent = click.UserAgent
+			}
+			if _, ok := counts[key]; !ok {
+				order = append(order, key)
+			}
+			counts[key]++
+		}
+	}
+
+	groups := make([]ClickGroup, 0, len(order))
+	for _, key := range order {
+		groups = append(groups, ClickGroup{
+			ClickRollup: key.rollupKey.rollup(counts[key]),
+			UserAgent:   key.userAgent,
+		})
+	}
+	return groups, nil
+}
+
+// rollup 將彙總鍵轉換為彙總記錄
+func (k rollupKey) rollup(clicks int) ClickRollup {
+	return ClickRollup{
+		URLID:           k.urlID,
+		Bucket:          time.Unix(k.bucket, 0).UTC(),
+		ClickDimensions: k.ClickDimensions,
+		Clicks:          clicks,
+	}
+}
+
+// ClickRollupWatermark 取得彙總進度
+func (s *MemoryStore) ClickRollupWatermark(ctx context.Context) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.rollupUntil, nil
+}
+
+// SaveClickRollups 累加每小時及每日彙總、合併訪客 sketch 並推進彙總進度
+func (s *MemoryStore) SaveClickRollups(ctx context.Context, rollups []ClickRollup, visitors []VisitorSketch, from, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.rollupUntil.Equal(from) {
+		return ErrRollupConflict
+	}
+	for _, r := range rollups {
+		s.hourlyRollups[rollupKey{urlID: r.URLID, bucket: r.Bucket.Unix(), ClickDimensions: r.ClickDimensions}] += r.Clicks
+		day := r.Bucket.UTC().Truncate(24 * time.Hour)
+		s.dailyRollups[rollupKey{urlID: r.URLID, bucket: day.Unix(), ClickDimensions: r.ClickDimensions}] += r.Clicks
+	}
+	mergeSketches(s.hourlyVisitors, visitors)
+	mergeSketches(s.dailyVisitors, dailySketches(visitors))
+	s.rollupUntil = until.UTC()
+	return nil
+}
+
+// ListClickRollups 取得短網址 [from, until) 的彙總：完整的 UTC 日使用每日彙總，其餘使用每小時彙總
+func (s *MemoryStore) ListClickRollups(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]ClickRollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dayFrom, dayUntil := rollupDays(from, until)
+	var rollups []ClickRollup
+	for key, clicks := range s.dailyRollups {
+		if key.urlID == urlID && key.bucket >= dayFrom.Unix() && key.bucket < dayUntil.Unix() {
+			rollups = append(rollups, key.rollup(clicks))
+		}
+	}
+	for key, clicks := range s.hourlyRollups {
+		if key.urlID != urlID || key.bucket < from.Unix() || key.bucket >= until.Unix() {
+			continue
+		}
+		if key.bucket < dayFrom.Unix() || key.bucket >= dayUntil.Unix() {
+			rollups = append(rollups, key.rollup(clicks))
+		}
+	}
+	return rollups, nil
+}
+
+// HourlyClicks 取得短網址 [from, until) 的每小時點擊數（舊到新）
+func (s *MemoryStore) HourlyClicks(ctx context.Context, urlID uuid.UUID, from, until time.Time, includeBots bool) ([]ClickRollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[int64]int)
+	for key, clicks := range s.hourlyRollups {
+		if key.IsBot && !includeBots {
+			continue
+		}
+		if key.urlID == urlID && key.bucket >= from.Unix() && key.bucket < until.Unix() {
+			counts[key.bucket] += clicks
+		}
+	}
+	return sortedBuckets(urlID, counts), nil
+}
+
+// MinuteClicks 依分鐘分組統計 [from, to) 內的原始點擊數（舊到新）
+func (s *MemoryStore) MinuteClicks(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool) ([]ClickRollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[int64]int)
+	for _, click := range s.clicks[urlID] {
+		if inRange(click.ClickedAt, from, to) && (includeBots || !click.IsBot) {
+			counts[click.ClickedAt.Truncate(time.Minute).Unix()]++
+		}
+	}
+	return sortedBuckets(urlID, counts), nil
+}
+
+// sortedBuckets 將各時間段的點擊數依時間排序（舊到新）
+func sortedBuckets(urlID uuid.UUID, counts map[int64]int) []ClickRollup {
+	rollups := make([]ClickRollup, 0, len(counts))
+	for bucket, clicks := range counts {
+		rollups = append(rollups, rollupKey{urlID: urlID, bucket: bucket}.rollup(clicks))
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		return rollups[i].Bucket.Before(rollups[j].Bucket)
+	})
+	return rollups
+}
+
+// mergeSketches 將訪客 sketch 合併到 sketches
+func mergeSketches(sketches map[visitorKey]*hll.Sketch, visitors []VisitorSketch) {
+	for _, v := range visitors {
+		key := visitorKey{urlID: v.URLID, bucket: v.Bucket.Unix(), variant: v.Variant}
+		if sketches[key] == nil {
+			sketches[key] = hll.New()
+		}
+		sketches[key].Merge(v.Sketch)
+	}
+}
+
+// copySketch 複製 sketch，避免呼叫者修改儲存的資料
+func copySketch(key visitorKey, sketch *hll.Sketch) VisitorSketch {
+	v := VisitorSketch{URLID: key.urlID, Bucket: time.Unix(key.bucket, 0).UTC(), Variant: key.variant, Sketch: hll.New()}
+	v.Sketch.Merge(sketch)
+	return v
+}
+
+// ClickVisitors 依時間段去重 [from, to) 內原始點擊的訪客指紋
+func (s *MemoryStore) ClickVisitors(ctx context.Context, scope ClickScope, unit time.Duration) ([]ClickVisitor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[ClickVisitor]bool)
+	var visitors []ClickVisitor
+	for id, clicks := range s.clicks {
+		for _, click := range clicks {
+			if click.VisitorHash == 0 || !scope.contains(&click) {
+				continue
+			}
+			v := ClickVisitor{URLID: id, Bucket: click.ClickedAt.UTC().Truncate(unit), Variant: click.Variant, VisitorHash: click.VisitorHash}
+			if !seen[v] {
+				seen[v] = true
+				visitors = append(visitors, v)
+			}
+		}
+	}
+	return visitors, nil
+}
+
+// ListVisitorSketches 取得短網址 [from, until) 的訪客 sketch：完整的 UTC 日使用每日 sketch，其餘使用每小時 sketch
+func (s *MemoryStore) ListVisitorSketches(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]VisitorSketch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dayFrom, dayUntil := rollupDays(from, until)
+	var visitors []VisitorSketch
+	for key, sketch := range s.dailyVisitors {
+		if key.urlID == urlID && key.bucket >= dayFrom.Unix() && key.bucket < dayUntil.Unix() {
+			visitors = append(visitors, copySketch(key, sketch))
+		}
+	}
+	for key, sketch := range s.hourlyVisitors {
+		if key.urlID != urlID || key.bucket < from.Unix() || key.bucket >= until.Unix() {
+			continue
+		}
+		if key.bucket < dayFrom.Unix() || key.bucket >= dayUntil.Unix() {
+			visitors = append(visitors, copySketch(key, sketch))
+		}
+	}
+	return visitors, nil
+}
+
+// HourlyVisitors 取得短網址 [from, until) 的每小時訪客 sketch
+func (s *MemoryStore) HourlyVisitors(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]VisitorSketch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var visitors []VisitorSketch
+	for key, sketch := range s.hourlyVisitors {
+		if key.urlID == urlID && key.bucket >= from.Unix() && key.bucket < until.Unix() {
+			visitors = append(visitors, copySketch(key, sketch))
+		}
+	}
+	sort.Slice(visitors, func(i, j int) bool {
+		return visitors[i].Bucket.Before(visitors[j].Bucket)
+	})
+	return visitors, nil
+}
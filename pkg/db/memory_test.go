@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"go-shorturl/pkg/models"
+)
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	maxClicks := 10
+	link := &models.URL{
+		OriginalURL: "https://example.com",
+		ShortCode:   "abc123",
+		MaxClicks:   &maxClicks,
+		Tags:        []string{"news"},
+		Rules:       []models.RedirectRule{{Name: "tw", Countries: []string{"TW"}, Destination: "https://example.com/tw"}},
+		Variants:    []models.Variant{{Name: "a", Destination: "https://example.com/a", Weight: 1}},
+	}
+	if err := store.CreateURL(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	// 修改建立時傳入的資料不影響已儲存的短網址
+	link.Tags[0] = "changed"
+	maxClicks = 1
+
+	found, err := store.GetURLByShortCode(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found.Rules[0].Countries[0] = "JP"
+	found.Variants[0].Weight = 5
+	*found.MaxClicks = 2
+
+	again, err := store.GetURLByShortCode(ctx, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Tags[0] != "news" {
+		t.Errorf("tags = %v, want [news]", again.Tags)
+	}
+	if again.Rules[0].Countries[0] != "TW" {
+		t.Errorf("rule countries = %v, want [TW]", again.Rules[0].Countries)
+	}
+	if again.Variants[0].Weight != 1 {
+		t.Errorf("variant weight = %d, want 1", again.Variants[0].Weight)
+	}
+	if *again.MaxClicks != 10 {
+		t.Errorf("max_clicks = %d, want 10", *again.MaxClicks)
+	}
+}
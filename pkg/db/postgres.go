@@ -0,0 +1,1171 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/hll"
+	"go-shorturl/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore 以 PostgreSQL 實作的 Store
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// NewPostgresStore 以連線池建立 PostgresStore
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool: pool}
+}
+
+// isUniqueViolation 判斷是否為唯一鍵衝突
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// NextSequence 取得下一個短碼序號
+func (s *PostgresStore) NextSequence(ctx context.Context) (uint64, error) {
+	var n int64
+	err := s.pool.QueryRow(ctx, "SELECT nextval('short_code_seq')").Scan(&n)
+	return uint64(n), err
+}
+
+// urlColumns urls 表查詢欄位，順序需與 scanURL 一致
+const urlColumns = "id, user_id, original_url, short_code, created_at, expires_at, max_clicks, enabled, deleted_at, updated_at, " +
+	"og_title, og_description, og_image, twitter_card, redirect_rules, variants, " +
+	"password_hash, failed_unlocks, redirect_status, query_passthrough, path_forwarding, " +
+	"active_from, prelaunch_url, campaign, " +
+	"ARRAY(SELECT tag FROM url_tags WHERE url_tags.url_id = id ORDER BY tag)"
+
+// scanURL 掃描一筆 urls 記錄，extra 為 urlColumns 之後的其他欄位
+func scanURL(row pgx.Row, extra ...any) (*models.URL, error) {
+	var u models.URL
+	dest := []any{&u.ID, &u.UserID, &u.OriginalURL, &u.ShortCode, &u.CreatedAt, &u.ExpiresAt, &u.MaxClicks,
+		&u.Enabled, &u.DeletedAt, &u.UpdatedAt, &u.OGTitle, &u.OGDescription, &u.OGImage, &u.TwitterCard,
+		&u.Rules, &u.Variants, &u.PasswordHash, &u.FailedUnlocks,
+		&u.RedirectStatus, &u.QueryPassthrough, &u.PathForwarding,
+		&u.ActiveFrom, &u.PrelaunchURL, &u.Campaign, &u.Tags}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	u.PasswordProtected = u.PasswordHash != ""
+	return &u, nil
+}
+
+// jsonArray 寫入 JSONB 陣列欄位（重定向規則、A/B 測試目標）的值，nil 時寫入空陣列
+func jsonArray[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// updateJSONArray 修改時的 JSONB 陣列欄位值，nil 表示不修改
+func updateJSONArray[T any](items *[]T) any {
+	if items == nil {
+		return nil
+	}
+	return jsonArray(*items)
+}
+
+// updateNullable 拆開可清除的欄位：是否修改及新的值（nil 表示清除）
+func updateNullable[T any](p **T) (bool, *T) {
+	if p == nil {
+		return false, nil
+	}
+	return true, *p
+}
+
+// insertURLQuery 新增一筆短網址及其標籤，參數順序與 insertURLArgs 一致
+const insertURLQuery = `
+	WITH inserted AS (
+		INSERT INTO urls (id, user_id, original_url, short_code, created_at, expires_at, max_clicks, enabled,
+			og_title, og_description, og_image, twitter_card, redirect_rules, variants,
+			password_hash, redirect_status, query_passthrough, path_forwarding,
+			active_from, prelaunch_url, campaign)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		RETURNING id, created_at
+	), tags AS (
+		INSERT INTO url_tags (url_id, tag)
+		SELECT inserted.id, unnest($22::text[]) FROM inserted
+	)
+	SELECT id, created_at FROM inserted
+`
+
+// insertURLArgs 新增短網址的參數
+func insertURLArgs(u *models.URL) []any {
+	return []any{
+		u.ID, u.UserID, u.OriginalURL, u.ShortCode, u.CreatedAt,
+		u.ExpiresAt, u.MaxClicks, u.Enabled, u.OGTitle, u.OGDescription, u.OGImage, u.TwitterCard,
+		jsonArray(u.Rules), jsonArray(u.Variants), u.PasswordHash,
+		u.RedirectStatus, u.QueryPassthrough, u.PathForwarding,
+		u.ActiveFrom, u.PrelaunchURL, u.Campaign, u.Tags,
+	}
+}
+
+// CreateURL 建立短網址
+func (s *PostgresStore) CreateURL(ctx context.Context, u *models.URL) error {
+	err := s.pool.QueryRow(ctx, insertURLQuery, insertURLArgs(u)...).Scan(&u.ID, &u.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrShortCodeExists
+	}
+	return err
+}
+
+// CreateURLs 在同一個交易中以批次建立多個短網址
+func (s *PostgresStore) CreateURLs(ctx context.Context, urls []*models.URL) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, u := range urls {
+		batch.Queue(insertURLQuery, insertURLArgs(u)...)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	for i, u := range urls {
+		if err := results.QueryRow().Scan(&u.ID, &u.CreatedAt); err != nil {
+			results.Close()
+			if isUniqueViolation(err) {
+				err = ErrShortCodeExists
+			}
+			return &BatchError{Index: i, Err: err}
+		}
+	}
+	if err := results.Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetURLByShortCode 依短碼查詢短網址
+func (s *PostgresStore) GetURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	query := "SELECT " + urlColumns + " FROM urls WHERE short_code = $1"
+	return scanURL(s.pool.QueryRow(ctx, query, shortCode))
+}
+
+// UpdateURL 修改短網址
+func (s *PostgresStore) UpdateURL(ctx context.Context, shortCode string, update URLUpdate) (*models.URL, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 鎖定記錄，避免並發修改時遺漏修改紀錄
+	current, err := scanURL(tx.QueryRow(ctx, "SELECT "+urlColumns+" FROM urls WHERE short_code = $1 FOR UPDATE", shortCode))
+	if err != nil {
+		return nil, err
+	}
+
+	if update.OriginalURL != nil && *update.OriginalURL != current.OriginalURL {
+		historyQuery := "INSERT INTO url_history (id, url_id, original_url, replaced_at) VALUES ($1, $2, $3, $4)"
+		if _, err := tx.Exec(ctx, historyQuery, uuid.New(), current.ID, current.OriginalURL, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+	}
+
+	// 標籤整組取代
+	if update.Tags != nil {
+		if _, err := tx.Exec(ctx, "DELETE FROM url_tags WHERE url_id = $1", current.ID); err != nil {
+			return nil, err
+		}
+		tagQuery := "INSERT INTO url_tags (url_id, tag) SELECT $1, unnest($2::text[])"
+		if _, err := tx.Exec(ctx, tagQuery, current.ID, *update.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE urls
+		SET original_url = COALESCE($2, original_url),
+			enabled = COALESCE($3, enabled),
+			og_title = COALESCE($5, og_title),
+			og_description = COALESCE($6, og_description),
+			og_image = COALESCE($7, og_image),
+			twitter_card = COALESCE($8, twitter_card),
+			redirect_rules = COALESCE($9, redirect_rules),
+			variants = COALESCE($10, variants),
+			password_hash = COALESCE($11, password_hash),
+			redirect_status = COALESCE($12, redirect_status),
+			query_passthrough = COALESCE($13, query_passthrough),
+			path_forwarding = COALESCE($14, path_forwarding),
+			active_from = CASE WHEN $15 THEN $18 ELSE active_from END,
+			expires_at = CASE WHEN $19 THEN $20 ELSE expires_at END,
+			max_clicks = CASE WHEN $21 THEN $22 ELSE max_clicks END,
+			prelaunch_url = COALESCE($16, prelaunch_url),
+			campaign = COALESCE($17, campaign),
+			updated_at = $4
+		WHERE id = $1
+		RETURNING ` + urlColumns
+
+	setActiveFrom, activeFrom := updateNullable(update.ActiveFrom)
+	setExpiresAt, expiresAt := updateNullable(update.ExpiresAt)
+	setMaxClicks, maxClicks := updateNullable(update.MaxClicks)
+	updated, err := scanURL(tx.QueryRow(ctx, query, current.ID, update.OriginalURL, update.Enabled, time.Now().UTC(),
+		update.OGTitle, update.OGDescription, update.OGImage, update.TwitterCard, updateJSONArray(update.Rules),
+		updateJSONArray(update.Variants), update.PasswordHash,
+		update.RedirectStatus, update.QueryPassthrough, update.PathForwarding,
+		setActiveFrom, update.PrelaunchURL, update.Campaign, activeFrom,
+		setExpiresAt, expiresAt, setMaxClicks, maxClicks))
+	if err != nil {
+		return nil, err
+	}
+	return updated, tx.Commit(ctx)
+}
+
+// SetURLDeleted 軟刪除或還原短網址
+func (s *PostgresStore) SetURLDeleted(ctx context.Context, shortCode string, deleted bool) (*models.URL, error) {
+	var deletedAt *time.Time
+	if deleted {
+		now := time.Now().UTC()
+		deletedAt = &now
+	}
+
+	query := "UPDATE urls SET deleted_at = $2, updated_at = $3 WHERE short_code = $1 RETURNING " + urlColumns
+	return scanURL(s.pool.QueryRow(ctx, query, shortCode, deletedAt, time.Now().UTC()))
+}
+
+// RecordFailedUnlock 累計一次密碼錯誤
+func (s *PostgresStore) RecordFailedUnlock(ctx context.Context, urlID uuid.UUID) error {
+	tag, err := s.pool.Exec(ctx, "UPDATE urls SET failed_unlocks = failed_unlocks + 1 WHERE id = $1", urlID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddUnlockAttempts 累計解鎖嘗試次數，ON CONFLICT 鎖定該列，同時送出的請求也會依序計數
+func (s *PostgresStore) AddUnlockAttempts(ctx context.Context, key string, n int, since time.Time) (int, error) {
+	query := `
+		INSERT INTO unlock_attempts (key, attempts, window_start)
+		VALUES ($1, GREATEST($2, 0), $3)
+		ON CONFLICT (key) DO UPDATE SET
+			attempts = CASE WHEN unlock_attempts.window_start < $4 THEN GREATEST($2, 0)
+				ELSE GREATEST(unlock_attempts.attempts + $2, 0) END,
+			window_start = CASE WHEN unlock_attempts.window_start < $4 THEN EXCLUDED.window_start
+				ELSE unlock_attempts.window_start END
+		RETURNING attempts
+	`
+	var attempts int
+	err := s.pool.QueryRow(ctx, query, key, n, time.Now().UTC(), since.UTC()).Scan(&attempts)
+	return attempts, err
+}
+
+// ResetUnlockAttempts 清除解鎖嘗試次數及過期記錄
+func (s *PostgresStore) ResetUnlockAttempts(ctx context.Context, key string, since time.Time) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM unlock_attempts WHERE key = $1 OR window_start < $2", key, since.UTC())
+	return err
+}
+
+// hostExpr 從網址欄位取出小寫主機名稱的 SQL 運算式，無法解析時為 NULL
+func hostExpr(column string) string {
+	return `lower(substring(` + column + ` from '^[^:/?#]+://(?:[^@/?#]*@)?([^:/?#]+)'))`
+}
+
+// urlStatusConditions 各狀態篩選的 SQL 條件，$1 為目前時間；點擊次數上限以包含爬蟲的所有點擊計算
+var urlStatusConditions = map[string]string{
+	"":                 "deleted_at IS NULL",
+	URLStatusDeleted:   "deleted_at IS NOT NULL",
+	URLStatusDisabled:  "deleted_at IS NULL AND NOT enabled",
+	URLStatusScheduled: "deleted_at IS NULL AND active_from > $1",
+	URLStatusExpired:   "deleted_at IS NULL AND (expires_at <= $1 OR click_count >= max_clicks)",
+	URLStatusActive: "deleted_at IS NULL AND enabled AND (active_from IS NULL OR active_from <= $1) " +
+		"AND (expires_at IS NULL OR expires_at > $1) AND (max_clicks IS NULL OR click_count < max_clicks)",
+}
+
+// escapeLike 轉義 LIKE 模式中的萬用字元
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// urlsWithClicks 附帶總點擊數（不含爬蟲）的 urls 子查詢，點擊數取自寫入點擊時累加的計數欄位
+const urlsWithClicks = `(
+		SELECT urls.*, urls.click_count - urls.bot_click_count AS total_clicks
+		FROM urls
+	) u`
+
+// urlQuery 組合列表查詢的條件及參數，$1 固定為目前時間
+type urlQuery struct {
+	args       []any
+	conditions []string
+}
+
+// arg 加入參數並返回其佔位符
+func (q *urlQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// newURLQuery 依篩選條件（不含游標）建立查詢條件
+func newURLQuery(filter URLFilter) (*urlQuery, error) {
+	statusCondition, ok := urlStatusConditions[filter.Status]
+	if !ok {
+		return nil, fmt.Errorf("unknown status filter %q", filter.Status)
+	}
+
+	q := &urlQuery{args: []any{time.Now().UTC()}, conditions: []string{statusCondition}}
+	if filter.UserID != nil {
+		q.conditions = append(q.conditions, "user_id = "+q.arg(*filter.UserID))
+	}
+	if filter.Domain != "" {
+		domain, host := q.arg(filter.Domain), hostExpr("original_url")
+		q.conditions = append(q.conditions, fmt.Sprintf("(%s = %s OR %s LIKE '%%.' || %s)", host, domain, host, domain))
+	}
+	if filter.Search != "" {
+		pattern := q.arg("%" + escapeLike(filter.Search) + "%")
+		q.conditions = append(q.conditions, fmt.Sprintf("(original_url ILIKE %s OR short_code ILIKE %s)", pattern, pattern))
+	}
+	if filter.Tag != "" {
+		q.conditions = append(q.conditions, "EXISTS (SELECT 1 FROM url_tags WHERE url_tags.url_id = id AND url_tags.tag = "+q.arg(filter.Tag)+")")
+	}
+	if filter.Campaign != "" {
+		q.conditions = append(q.conditions, "campaign = "+q.arg(filter.Campaign))
+	}
+	return q, nil
+}
+
+// where 返回 WHERE 子句的條件
+func (q *urlQuery) where() string {
+	return strings.Join(q.conditions, " AND ")
+}
+
+// ListURLs 依條件列出短網址及其總點擊數，以 (排序值, id) 作為分頁游標
+func (s *PostgresStore) ListURLs(ctx context.Context, filter URLFilter) ([]models.LinkSummary, error) {
+	q, err := newURLQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sortColumn := "created_at"
+	var cursorValue any
+	if filter.After != nil {
+		cursorValue = filter.After.CreatedAt
+	}
+	if filter.Sort == URLSortClicks {
+		sortColumn = "total_clicks"
+		if filter.After != nil {
+			cursorValue = filter.After.Clicks
+		}
+	}
+	direction, comparison := "DESC", "<"
+	if filter.Asc {
+		direction, comparison = "ASC", ">"
+	}
+	if filter.After != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", sortColumn, comparison, q.arg(cursorValue), q.arg(filter.After.ID)))
+	}
+
+	query := `
+		SELECT ` + urlColumns + `, total_clicks
+		FROM ` + urlsWithClicks + `
+		WHERE ` + q.where() + `
+		ORDER BY ` + sortColumn + " " + direction + ", id " + direction + `
+		LIMIT ` + q.arg(filter.Limit)
+
+	rows, err := s.pool.Query(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []models.LinkSummary
+	for rows.Next() {
+		var totalClicks int
+		u, err := scanURL(rows, &totalClicks)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, models.LinkSummary{URL: *u, TotalClicks: totalClicks})
+	}
+	return links, rows.Err()
+}
+
+// ListURLGroups 依標籤或活動分組統計短網址數及總點擊數
+func (s *PostgresStore) ListURLGroups(ctx context.Context, filter URLFilter, by string) ([]models.GroupStat, error) {
+	q, err := newURLQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var query string
+	switch by {
+	case URLGroupTag:
+		query = `
+			SELECT t.tag, COUNT(*), COALESCE(SUM(u.total_clicks), 0)::bigint
+			FROM ` + urlsWithClicks + `
+			JOIN url_tags t ON t.url_id = u.id
+			WHERE ` + q.where() + `
+			GROUP BY t.tag
+			ORDER BY 3 DESC, 1`
+	case URLGroupCampaign:
+		query = `
+			SELECT campaign, COUNT(*), COALESCE(SUM(total_clicks), 0)::bigint
+			FROM ` + urlsWithClicks + `
+			WHERE ` + q.where() + ` AND campaign != ''
+			GROUP BY campaign
+			ORDER BY 3 DESC, 1`
+	default:
+		return nil, fmt.Errorf("unknown grouping %q", by)
+	}
+
+	rows, err := s.pool.Query(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.GroupStat
+	for rows.Next() {
+		var group models.GroupStat
+		if err := rows.Scan(&group.Name, &group.TotalLinks, &group.TotalClicks); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// ListURLHistory 取得目標網址修改紀錄
+func (s *PostgresStore) ListURLHistory(ctx context.Context, urlID uuid.UUID) ([]models.URLHistory, error) {
+	query := `
+		SELECT id, url_id, original_url, replaced_at
+		FROM url_history
+		WHERE url_id = $1
+		ORDER BY replaced_at DESC
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.URLHistory
+	for rows.Next() {
+		var entry models.URLHistory
+		if err := rows.Scan(&entry.ID, &entry.URLID, &entry.OriginalURL, &entry.ReplacedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+// GetLinkPreview 取得快取的 Open Graph 信息
+func (s *PostgresStore) GetLinkPreview(ctx context.Context, urlID uuid.UUID) (*models.LinkPreview, error) {
+	query := `
+		SELECT url_id, source_url, title, description, image, type, site_name, fetched_at
+		FROM link_previews
+		WHERE url_id = $1
+	`
+
+	var preview models.LinkPreview
+	err := s.pool.QueryRow(ctx, query, urlID).Scan(&preview.URLID, &preview.SourceURL, &preview.Title,
+		&preview.Description, &preview.Image, &preview.Type, &preview.SiteName, &preview.FetchedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// SaveLinkPreview 儲存（覆蓋）Open Graph 信息
+func (s *PostgresStore) SaveLinkPreview(ctx context.Context, preview *models.LinkPreview) error {
+	query := `
+		INSERT INTO link_previews (url_id, source_url, title, description, image, type, site_name, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (url_id) DO UPDATE SET
+			source_url = EXCLUDED.source_url,
+			title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			image = EXCLUDED.image,
+			type = EXCLUDED.type,
+			site_name = EXCLUDED.site_name,
+			fetched_at = EXCLUDED.fetched_at
+	`
+	_, err := s.pool.Exec(ctx, query, preview.URLID, preview.SourceURL, preview.Title, preview.Description,
+		preview.Image, preview.Type, preview.SiteName, preview.FetchedAt.UTC())
+	return err
+}
+
+// apiKeyColumns api_keys 表查詢欄位，順序需與 scanAPIKey 一致
+const apiKeyColumns = "id, user_id, name, key_prefix, key_hash, created_at, revoked_at"
+
+// scanAPIKey 掃描一筆 api_keys 記錄
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateAPIKey 建立 API 金鑰
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (id, user_id, name, key_prefix, key_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := s.pool.Exec(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, key.CreatedAt)
+	return err
+}
+
+// GetAPIKey 依 ID 查詢 API 金鑰
+func (s *PostgresStore) GetAPIKey(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE id = $1"
+	return scanAPIKey(s.pool.QueryRow(ctx, query, id))
+}
+
+// GetAPIKeyByHash 依雜湊值查詢 API 金鑰
+func (s *PostgresStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE key_hash = $1"
+	return scanAPIKey(s.pool.QueryRow(ctx, query, keyHash))
+}
+
+// ListAPIKeys 取得使用者的所有 API 金鑰，userID 為 nil 時返回所有金鑰
+func (s *PostgresStore) ListAPIKeys(ctx context.Context, userID *uuid.UUID) ([]models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE $1::uuid IS NULL OR user_id = $1 ORDER BY created_at DESC"
+
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey 撤銷 API 金鑰
+func (s *PostgresStore) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	query := "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1"
+	tag, err := s.pool.Exec(ctx, query, id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// clickColumns 點擊記錄寫入欄位，順序與 clickValues 一致
+var clickColumns = []string{
+	"id", "url_id", "clicked_at", "ip_address", "user_agent", "referrer", "device_type", "os", "location",
+	"location_isp", "location_hostname", "location_country", "location_region", "location_city", "location_zip",
+	"target", "variant", "visitor_hash", "is_bot", "bot_name",
+}
+
+// clickValues 點擊記錄的欄位值
+func clickValues(click *models.Click) []any {
+	return []any{
+		click.ID, click.URLID, click.ClickedAt.UTC(), click.IPAddress, click.UserAgent, click.Referrer,
+		click.DeviceType, click.OS, click.Location, click.LocationISP, click.LocationHostname,
+		click.LocationCountry, click.LocationRegion, click.LocationCity, click.LocationZip,
+		click.Target, click.Variant, click.VisitorHash, click.IsBot, click.BotName,
+	}
+}
+
+// RecordClick 記錄一次點擊
+func (s *PostgresStore) RecordClick(ctx context.Context, click *models.Click) error {
+	query := `
+		INSERT INTO clicks (id, url_id, clicked_at, ip_address, user_agent, referrer, device_type, os, location,
+			location_isp, location_hostname, location_country, location_region, location_city, location_zip, target,
+			variant, visitor_hash, is_bot, bot_name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	`
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, query, clickValues(click)...); err != nil {
+		return err
+	}
+	if err := addClickCounts(ctx, tx, []models.Click{*click}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RecordClicks 以 COPY 批次寫入點擊記錄
+func (s *PostgresStore) RecordClicks(ctx context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"clicks"}, clickColumns,
+		pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+			return clickValues(&clicks[i]), nil
+		}))
+	if err != nil {
+		return err
+	}
+	if err := addClickCounts(ctx, tx, clicks); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// addClickCounts 累加短網址的點擊數及爬蟲點擊數
+// 依短網址 ID 排序後逐筆更新，同時寫入的批次以相同順序鎖定，避免死結
+func addClickCounts(ctx context.Context, tx pgx.Tx, clicks []models.Click) error {
+	type counts struct{ total, bots int }
+	byURL := make(map[uuid.UUID]*counts)
+	for i := range clicks {
+		c, ok := byURL[clicks[i].URLID]
+		if !ok {
+			c = &counts{}
+			byURL[clicks[i].URLID] = c
+		}
+		c.total++
+		if clicks[i].IsBot {
+			c.bots++
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(byURL))
+	for id := range byURL {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int {
+		return bytes.Compare(a[:], b[:])
+	})
+
+	batch := &pgx.Batch{}
+	for _, id := range ids {
+		batch.Queue("UPDATE urls SET click_count = click_count + $2, bot_click_count = bot_click_count + $3 WHERE id = $1",
+			id, byURL[id].total, byURL[id].bots)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// botCondition 排除爬蟲點擊的查詢條件
+func botCondition(includeBots bool) string {
+	if includeBots {
+		return ""
+	}
+	return " AND NOT is_bot"
+}
+
+// ListClicks 取得 [from, to) 內最近的 limit 筆點擊（新到舊）
+func (s *PostgresStore) ListClicks(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.Click, error) {
+	query := `
+		SELECT
+			clicked_at,
+			COALESCE(ip_address, '') as ip_address,
+			COALESCE(location, '') as location,
+			COALESCE(device_type, '') as device_type,
+			COALESCE(location_isp, '') as location_isp,
+			COALESCE(location_hostname, '') as location_hostname,
+			COALESCE(location_country, '') as location_country,
+			COALESCE(location_region, '') as location_region,
+			COALESCE(location_city, '') as location_city,
+			COALESCE(location_zip, '') as location_zip,
+			is_bot,
+			bot_name
+		FROM clicks
+		WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3` + botCondition(includeBots) + `
+		ORDER BY clicked_at DESC
+		LIMIT $4
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clicks []models.Click
+	for rows.Next() {
+		var click models.Click
+		if err := rows.Scan(&click.ClickedAt, &click.IPAddress, &click.Location, &click.DeviceType,
+			&click.LocationISP, &click.LocationHostname, &click.LocationCountry,
+			&click.LocationRegion, &click.LocationCity, &click.LocationZip, &click.IsBot, &click.BotName); err != nil {
+			return nil, err
+		}
+		clicks = append(clicks, click)
+	}
+	return clicks, rows.Err()
+}
+
+// CountClicks 取得總點擊數（包含爬蟲），讀取寫入點擊時累加的計數欄位
+func (s *PostgresStore) CountClicks(ctx context.Context, urlID uuid.UUID) (int, error) {
+	var total int
+	err := s.pool.QueryRow(ctx, "SELECT click_count FROM urls WHERE id = $1", urlID).Scan(&total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return total, err
+}
+
+// UserAgentStats 依 User-Agent 分組統計
+func (s *PostgresStore) UserAgentStats(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.DeviceStat, error) {
+	query := `
+		SELECT user_agent, COUNT(*) as count
+		FROM clicks
+		WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3 AND user_agent IS NOT NULL AND user_agent != ''` + botCondition(includeBots) + `
+		GROUP BY user_agent
+		ORDER BY count DESC
+		LIMIT $4
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []models.DeviceStat
+	for rows.Next() {
+		var stat models.DeviceStat
+		if err := rows.Scan(&stat.UserAgent, &stat.Count); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// IPStats 依 IP 地址分組統計
+func (s *PostgresStore) IPStats(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.IPStat, error) {
+	query := `
+		SELECT ip_address, COUNT(*) as count
+		FROM clicks
+		WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3 AND ip_address IS NOT NULL AND ip_address != ''` + botCondition(includeBots) + `
+		GROUP BY ip_address
+		ORDER BY count DESC
+		LIMIT $4
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []models.IPStat
+	for rows.Next() {
+		var stat models.IPStat
+		if err := rows.Scan(&stat.IPAddress, &stat.Count); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// clickScopeConditions 原始點擊查詢範圍的 SQL 條件及參數（clicked_at、inserted_at 以 UTC 儲存）
+func clickScopeConditions(scope ClickScope) (string, []any) {
+	conditions := []string{"TRUE"}
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, condition+" $"+strconv.Itoa(len(args)))
+	}
+	if scope.URLID != nil {
+		add("url_id =", *scope.URLID)
+	}
+	if !scope.From.IsZero() {
+		add("clicked_at >=", scope.From.UTC())
+	}
+	if !scope.To.IsZero() {
+		add("clicked_at <", scope.To.UTC())
+	}
+	if !scope.InsertedFrom.IsZero() {
+		add("inserted_at >=", scope.InsertedFrom.UTC())
+	}
+	if !scope.InsertedUntil.IsZero() {
+		add("inserted_at <", scope.InsertedUntil.UTC())
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// ClickGroups 依小時及彙總維度分組原始點擊，已記錄設備類型及操作系統的點擊不附帶 User-Agent
+func (s *PostgresStore) ClickGroups(ctx context.Context, scope ClickScope) ([]ClickGroup, error) {
+	conditions, args := clickScopeConditions(scope)
+
+	query := `
+		SELECT url_id, date_trunc('hour', clicked_at) as bucket,
+			COALESCE(device_type, '') as device_type,
+			COALESCE(os, '') as os,
+			COALESCE(location_country, '') as country,
+			COALESCE(` + hostExpr("referrer") + `, '') as referrer_domain,
+			COALESCE(target, '') as target,
+			is_bot,
+			COALESCE(bot_name, '') as bot_name,
+			COALESCE(variant, '') as variant,
+			CASE
+				WHEN COALESCE(device_type, '') = '' OR COALESCE(os, '') = '' THEN COALESCE(user_agent, '')
+				ELSE ''
+			END as user_agent,
+			COUNT(*) as clicks
+		FROM clicks
+		WHERE ` + conditions + `
+		GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11
+	`
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []ClickGroup
+	for rows.Next() {
+		var g ClickGroup
+		if err := rows.Scan(&g.URLID, &g.Bucket, &g.DeviceType, &g.OS, &g.Country, &g.ReferrerDomain,
+			&g.Target, &g.IsBot, &g.BotName, &g.Variant, &g.UserAgent, &g.Clicks); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// ClickRollupWatermark 取得彙總進度
+func (s *PostgresStore) ClickRollupWatermark(ctx context.Context) (time.Time, error) {
+	var until time.Time
+	err := s.pool.QueryRow(ctx, "SELECT hourly_until FROM click_rollup_state").Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, ErrNotFound
+	}
+	return until, err
+}
+
+// rollupColumns 彙總表的維度欄位
+const rollupColumns = "device_type, os, country, referrer_domain, target, is_bot, bot_name, variant"
+
+// SaveClickRollups 在同一個交易中累加每小時及每日彙總、合併訪客 sketch 並推進彙總進度
+func (s *PostgresStore) SaveClickRollups(ctx context.Context, rollups []ClickRollup, visitors []VisitorSketch, from, until time.Time) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 鎖定進度，避免多個程序重複累加同一段時間
+	var current time.Time
+	if err := tx.QueryRow(ctx, "SELECT hourly_until FROM click_rollup_state FOR UPDATE").Scan(&current); err != nil {
+		return err
+	}
+	if !current.Equal(from) {
+		return ErrRollupConflict
+	}
+
+	if len(rollups) > 0 {
+		n := len(rollups)
+		urlIDs, buckets, clicks := make([]uuid.UUID, n), make([]time.Time, n), make([]int, n)
+		deviceTypes, oses, countries, referrers, targets := make([]string, n), make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+		isBots, bots, variants := make([]bool, n), make([]string, n), make([]string, n)
+		for i, r := range rollups {
+			urlIDs[i], buckets[i], clicks[i] = r.URLID, r.Bucket.UTC(), r.Clicks
+			deviceTypes[i], oses[i], countries[i], referrers[i], targets[i] = r.DeviceType, r.OS, r.Country, r.ReferrerDomain, r.Target
+			isBots[i], bots[i], variants[i] = r.IsBot, r.BotName, r.Variant
+		}
+
+		source := `unnest($1::uuid[], $2::timestamp[], $3::text[], $4::text[], $5::text[], $6::text[], $7::bool[], $8::text[], $9::text[], $10::text[], $11::int[])
+			AS r(url_id, bucket, ` + rollupColumns + `, clicks)`
+		queries := []string{`
+			INSERT INTO click_rollups_hourly (url_id, bucket, ` + rollupColumns + `, clicks)
+			SELECT * FROM ` + source + `
+			ON CONFLICT (url_id, bucket, ` + rollupColumns + `)
+			DO UPDATE SET clicks = click_rollups_hourly.clicks + EXCLUDED.clicks
+		`, `
+			INSERT INTO click_rollups_daily (url_id, bucket, ` + rollupColumns + `, clicks)
+			SELECT url_id, date_trunc('day', bucket), ` + rollupColumns + `, SUM(clicks)
+			FROM ` + source + `
+			GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10
+			ON CONFLICT (url_id, bucket, ` + rollupColumns + `)
+			DO UPDATE SET clicks = click_rollups_daily.clicks + EXCLUDED.clicks
+		`}
+		for _, query := range queries {
+			if _, err := tx.Exec(ctx, query, urlIDs, buckets, deviceTypes, oses, countries, referrers, targets, isBots, bots, variants, clicks); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := mergeVisitorSketches(ctx, tx, "click_visitors_hourly", visitors); err != nil {
+		return err
+	}
+	if err := mergeVisitorSketches(ctx, tx, "click_visitors_daily", dailySketches(visitors)); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE click_rollup_state SET hourly_until = $1", until.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// mergeVisitorSketches 將訪客 sketch 合併到 table 中已有的 sketch（呼叫者須持有彙總進度的鎖）
+func mergeVisitorSketches(ctx context.Context, tx pgx.Tx, table string, visitors []VisitorSketch) error {
+	if len(visitors) == 0 {
+		return nil
+	}
+
+	n := len(visitors)
+	urlIDs, buckets, variants := make([]uuid.UUID, n), make([]time.Time, n), make([]string, n)
+	for i, v := range visitors {
+		urlIDs[i], buckets[i], variants[i] = v.URLID, v.Bucket.UTC(), v.Variant
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT t.url_id, t.bucket, t.variant, t.sketch
+		FROM `+table+` t
+		JOIN unnest($1::uuid[], $2::timestamp[], $3::text[]) AS k(url_id, bucket, variant)
+			ON t.url_id = k.url_id AND t.bucket = k.bucket AND t.variant = k.variant
+		FOR UPDATE OF t
+	`, urlIDs, buckets, variants)
+	if err != nil {
+		return err
+	}
+	existing, err := scanVisitorSketches(rows)
+	if err != nil {
+		return err
+	}
+	merged := make(map[visitorKey]*hll.Sketch, len(existing))
+	for _, v := range existing {
+		merged[visitorKey{urlID: v.URLID, bucket: v.Bucket.Unix(), variant: v.Variant}] = v.Sketch
+	}
+
+	sketches := make([][]byte, n)
+	for i, v := range visitors {
+		sketch := hll.New()
+		sketch.Merge(merged[visitorKey{urlID: v.URLID, bucket: v.Bucket.Unix(), variant: v.Variant}])
+		sketch.Merge(v.Sketch)
+		if sketches[i], err = sketch.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO `+table+` (url_id, bucket, variant, sketch)
+		SELECT * FROM unnest($1::uuid[], $2::timestamp[], $3::text[], $4::bytea[])
+		ON CONFLICT (url_id, bucket, variant) DO UPDATE SET sketch = EXCLUDED.sketch
+	`, urlIDs, buckets, variants, sketches)
+	return err
+}
+
+// scanVisitorSketches 掃描訪客 sketch
+func scanVisitorSketches(rows pgx.Rows) ([]VisitorSketch, error) {
+	defer rows.Close()
+
+	var visitors []VisitorSketch
+	for rows.Next() {
+		var v VisitorSketch
+		var data []byte
+		if err := rows.Scan(&v.URLID, &v.Bucket, &v.Variant, &data); err != nil {
+			return nil, err
+		}
+		v.Sketch = hll.New()
+		if err := v.Sketch.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		visitors = append(visitors, v)
+	}
+	return visitors, rows.Err()
+}
+
+// scanClickRollups 掃描彙總記錄
+func scanClickRollups(rows pgx.Rows) ([]ClickRollup, error) {
+	defer rows.Close()
+
+	var rollups []ClickRollup
+	for rows.Next() {
+		var r ClickRollup
+		if err := rows.Scan(&r.URLID, &r.Bucket, &r.DeviceType, &r.OS, &r.Country, &r.ReferrerDomain,
+			&r.Target, &r.IsBot, &r.BotName, &r.Variant, &r.Clicks); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// scanBucketClicks 掃描只有短網址、時間段及點擊數的記錄
+func scanBucketClicks(rows pgx.Rows) ([]ClickRollup, error) {
+	defer rows.Close()
+
+	var rollups []ClickRollup
+	for rows.Next() {
+		var r ClickRollup
+		if err := rows.Scan(&r.URLID, &r.Bucket, &r.Clicks); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// ListClickRollups 取得短網址 [from, until) 的彙總：完整的 UTC 日使用每日彙總，其餘使用每小時彙總
+func (s *PostgresStore) ListClickRollups(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]ClickRollup, error) {
+	dayFrom, dayUntil := rollupDays(from, until)
+	query := `
+		SELECT url_id, bucket, ` + rollupColumns + `, clicks
+		FROM click_rollups_daily
+		WHERE url_id = $1 AND bucket >= $3 AND bucket < $4
+		UNION ALL
+		SELECT url_id, bucket, ` + rollupColumns + `, clicks
+		FROM click_rollups_hourly
+		WHERE url_id = $1 AND bucket >= $2 AND bucket < $5
+			AND (bucket < $3 OR bucket >= $4)
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), dayFrom, dayUntil, until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanClickRollups(rows)
+}
+
+// HourlyClicks 取得短網址 [from, until) 的每小時點擊數（舊到新）
+func (s *PostgresStore) HourlyClicks(ctx context.Context, urlID uuid.UUID, from, until time.Time, includeBots bool) ([]ClickRollup, error) {
+	query := `
+		SELECT url_id, bucket, SUM(clicks)::int as clicks
+		FROM click_rollups_hourly
+		WHERE url_id = $1 AND bucket >= $2 AND bucket < $3` + botCondition(includeBots) + `
+		GROUP BY url_id, bucket
+		ORDER BY bucket
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanBucketClicks(rows)
+}
+
+// MinuteClicks 依分鐘分組統計 [from, to) 內的原始點擊數（舊到新）
+func (s *PostgresStore) MinuteClicks(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool) ([]ClickRollup, error) {
+	query := `
+		SELECT url_id, date_trunc('minute', clicked_at) as bucket, COUNT(*)::int as clicks
+		FROM clicks
+		WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3` + botCondition(includeBots) + `
+		GROUP BY url_id, bucket
+		ORDER BY bucket
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanBucketClicks(rows)
+}
+
+// ClickVisitors 依時間段去重 [from, to) 內原始點擊的訪客指紋
+func (s *PostgresStore) ClickVisitors(ctx context.Context, scope ClickScope, unit time.Duration) ([]ClickVisitor, error) {
+	trunc := "hour"
+	if unit == time.Minute {
+		trunc = "minute"
+	}
+	conditions, args := clickScopeConditions(scope)
+	conditions += " AND visitor_hash != 0"
+
+	query := `
+		SELECT url_id, date_trunc('` + trunc + `', clicked_at) as bucket, COALESCE(variant, '') as variant, visitor_hash
+		FROM clicks
+		WHERE ` + conditions + `
+		GROUP BY 1, 2, 3, 4
+	`
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visitors []ClickVisitor
+	for rows.Next() {
+		var v ClickVisitor
+		if err := rows.Scan(&v.URLID, &v.Bucket, &v.Variant, &v.VisitorHash); err != nil {
+			return nil, err
+		}
+		visitors = append(visitors, v)
+	}
+	return visitors, rows.Err()
+}
+
+// ListVisitorSketches 取得短網址 [from, until) 的訪客 sketch：完整的 UTC 日使用每日 sketch，其餘使用每小時 sketch
+func (s *PostgresStore) ListVisitorSketches(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]VisitorSketch, error) {
+	dayFrom, dayUntil := rollupDays(from, until)
+	query := `
+		SELECT url_id, bucket, variant, sketch
+		FROM click_visitors_daily
+		WHERE url_id = $1 AND bucket >= $3 AND bucket < $4
+		UNION ALL
+		SELECT url_id, bucket, variant, sketch
+		FROM click_visitors_hourly
+		WHERE url_id = $1 AND bucket >= $2 AND bucket < $5
+			AND (bucket < $3 OR bucket >= $4)
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), dayFrom, dayUntil, until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanVisitorSketches(rows)
+}
+
+// HourlyVisitors 取得短網址 [from, until) 的每小時訪客 sketch
+func (s *PostgresStore) HourlyVisitors(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]VisitorSketch, error) {
+	query := `
+		SELECT url_id, bucket, variant, sketch
+		FROM click_visitors_hourly
+		WHERE url_id = $1 AND bucket >= $2 AND bucket < $3
+		ORDER BY bucket
+	`
+
+	rows, err := s.pool.Query(ctx, query, urlID, from.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanVisitorSketches(rows)
+}
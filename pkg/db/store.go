@@ -0,0 +1,278 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-shorturl/pkg/hll"
+	"go-shorturl/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound 查無資料
+	ErrNotFound = errors.New("record not found")
+	// ErrShortCodeExists 短碼已被使用
+	ErrShortCodeExists = errors.New("short code already exists")
+	// ErrRollupConflict 彙總進度已被其他程序更新
+	ErrRollupConflict = errors.New("click rollup watermark has moved")
+)
+
+// BatchError 批次操作中第 Index 筆（從 0 開始）失敗，整批都未寫入
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// URLUpdate 短網址可修改的欄位，nil 表示不修改
+type URLUpdate struct {
+	OriginalURL   *string
+	Enabled       *bool
+	OGTitle       *string
+	OGDescription *string
+	OGImage       *string
+	TwitterCard   *string
+	Rules         *[]models.RedirectRule
+	Variants      *[]models.Variant
+	PasswordHash  *string // 空字串表示移除密碼
+
+	RedirectStatus   *int
+	QueryPassthrough *string
+	PathForwarding   *bool
+	ActiveFrom       **time.Time // 指向 nil 表示清除
+	ExpiresAt        **time.Time // 指向 nil 表示清除
+	MaxClicks        **int       // 指向 nil 表示清除
+	PrelaunchURL     *string
+	Tags             *[]string // 整組取代
+	Campaign         *string
+}
+
+// 短網址列表的狀態篩選
+const (
+	URLStatusActive    = "active"    // 已啟用、已開放且未失效
+	URLStatusDisabled  = "disabled"  // 已停用
+	URLStatusExpired   = "expired"   // 已過期或達到點擊上限
+	URLStatusScheduled = "scheduled" // 尚未到開放時間
+	URLStatusDeleted   = "deleted"   // 已軟刪除
+)
+
+// 短網址列表的排序欄位
+const (
+	URLSortCreatedAt = "created_at"
+	URLSortClicks    = "clicks"
+)
+
+// 標籤或活動彙總統計的分組方式
+const (
+	URLGroupTag      = "tag"
+	URLGroupCampaign = "campaign"
+)
+
+// URLCursor 列表分頁游標，記錄上一頁最後一筆的排序值
+// 依點擊數排序時點擊數在翻頁期間仍會改變，短網址可能在後續頁面重複出現或被略過
+type URLCursor struct {
+	CreatedAt time.Time
+	Clicks    int
+	ID        uuid.UUID
+}
+
+// URLFilter 短網址列表的查詢條件，零值表示不篩選
+type URLFilter struct {
+	UserID   *uuid.UUID // 只列出該使用者的短網址，nil 表示所有使用者
+	Domain   string     // 目標網址的網域（包含子網域），小寫
+	Status   string     // URLStatus*，空字串表示所有未刪除的短網址
+	Search   string     // 目標網址或短碼包含的文字（不分大小寫）
+	Tag      string     // 包含該標籤
+	Campaign string     // 屬於該活動
+
+	Sort  string     // URLSort*，預設 URLSortCreatedAt
+	Asc   bool       // 是否由小到大排序
+	After *URLCursor // 從游標之後開始，nil 表示第一頁
+	Limit int
+}
+
+// ClickDimensions 點擊彙總的分組維度
+type ClickDimensions struct {
+	DeviceType     string
+	OS             string
+	Country        string
+	ReferrerDomain string // 來源網址的主機名稱，空字串表示直接訪問
+	Target         string // 命中的重定向規則名稱，空字串表示預設目標網址
+	IsBot          bool   // 是否來自爬蟲，統計依此排除爬蟲的點擊
+	BotName        string // 爬蟲名稱，只用於分組顯示
+	Variant        string // 分配到的 A/B 測試目標，空字串表示未參與分流
+}
+
+// ClickRollup 同一短網址在一個時間段內維度相同的點擊數
+type ClickRollup struct {
+	URLID  uuid.UUID
+	Bucket time.Time // 時間段起點（UTC 整點或零時）
+	ClickDimensions
+	Clicks int
+}
+
+// ClickVisitor 一個時間段內點擊過短網址的訪客指紋
+type ClickVisitor struct {
+	URLID       uuid.UUID
+	Bucket      time.Time
+	Variant     string
+	VisitorHash int64
+}
+
+// VisitorSketch 同一短網址在一個時間段內分配到同一 A/B 測試目標的訪客 HyperLogLog sketch
+type VisitorSketch struct {
+	URLID   uuid.UUID
+	Bucket  time.Time // 時間段起點（UTC 整點或零時）
+	Variant string    // 空字串表示未參與分流
+	Sketch  *hll.Sketch
+}
+
+// rollupDays 取得 [from, until) 內完整 UTC 日的範圍，沒有完整的一天時返回 until, until
+func rollupDays(from, until time.Time) (time.Time, time.Time) {
+	dayFrom := from.UTC().Truncate(24 * time.Hour)
+	if dayFrom.Before(from) {
+		dayFrom = dayFrom.Add(24 * time.Hour)
+	}
+	dayUntil := until.UTC().Truncate(24 * time.Hour)
+	if !dayFrom.Before(dayUntil) {
+		return until.UTC(), until.UTC()
+	}
+	return dayFrom, dayUntil
+}
+
+// visitorKey 訪客 sketch 的唯一鍵
+type visitorKey struct {
+	urlID   uuid.UUID
+	bucket  int64 // Unix 秒
+	variant string
+}
+
+// dailySketches 將每小時訪客 sketch 合併為每日（UTC）sketch
+func dailySketches(visitors []VisitorSketch) []VisitorSketch {
+	index := make(map[visitorKey]int)
+	var daily []VisitorSketch
+	for _, v := range visitors {
+		day := v.Bucket.UTC().Truncate(24 * time.Hour)
+		key := visitorKey{urlID: v.URLID, bucket: day.Unix(), variant: v.Variant}
+		i, ok := index[key]
+		if !ok {
+			i = len(daily)
+			index[key] = i
+			daily = append(daily, VisitorSketch{URLID: v.URLID, Bucket: day, Variant: v.Variant, Sketch: hll.New()})
+		}
+		daily[i].Sketch.Merge(v.Sketch)
+	}
+	return daily
+}
+
+// ClickScope 原始點擊的查詢範圍，零值的欄位表示不限
+type ClickScope struct {
+	URLID *uuid.UUID // nil 表示所有短網址
+	From  time.Time  // 點擊時間 [From, To)
+	To    time.Time
+
+	// 寫入時間 [InsertedFrom, InsertedUntil)：彙總進度以寫入時間推進，點擊時間較早但較晚寫入的點擊也會被彙總
+	InsertedFrom  time.Time
+	InsertedUntil time.Time
+}
+
+// ClickGroup 依小時及彙總維度分組的原始點擊
+// 設備類型或操作系統未記錄（舊資料）時附帶 User-Agent，由呼叫者重新解析
+type ClickGroup struct {
+	ClickRollup
+	UserAgent string
+}
+
+// Store 資料存取介面，讓處理器不直接依賴特定資料庫
+type Store interface {
+	// NextSequence 取得下一個短碼序號（由 shortcode.Generator 使用）
+	NextSequence(ctx context.Context) (uint64, error)
+	// CreateURL 建立短網址，短碼重複時返回 ErrShortCodeExists
+	CreateURL(ctx context.Context, u *models.URL) error
+	// CreateURLs 在同一個交易中建立多個短網址（短碼需已指定），任一筆失敗時全部不寫入並返回 *BatchError
+	CreateURLs(ctx context.Context, urls []*models.URL) error
+	// GetURLByShortCode 依短碼查詢短網址，不存在時返回 ErrNotFound
+	GetURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error)
+	// UpdateURL 修改短網址，目標網址變更時會保存舊目標網址到修改紀錄
+	UpdateURL(ctx context.Context, shortCode string, update URLUpdate) (*models.URL, error)
+	// SetURLDeleted 軟刪除或還原短網址
+	SetURLDeleted(ctx context.Context, shortCode string, deleted bool) (*models.URL, error)
+	// RecordFailedUnlock 累計一次密碼錯誤
+	RecordFailedUnlock(ctx context.Context, urlID uuid.UUID) error
+	// AddUnlockAttempts 以單一原子操作累計 key 的解鎖嘗試次數（n 可為負數以退回）並返回累計後的次數，
+	// 計數開始時間早於 since 時從 0 重新計算
+	AddUnlockAttempts(ctx context.Context, key string, n int, since time.Time) (int, error)
+	// ResetUnlockAttempts 清除 key 的解鎖嘗試次數，並刪除計數開始時間早於 since 的過期記錄
+	ResetUnlockAttempts(ctx context.Context, key string, since time.Time) error
+	// ListURLs 依條件列出短網址及其總點擊數
+	ListURLs(ctx context.Context, filter URLFilter) ([]models.LinkSummary, error)
+	// ListURLGroups 依標籤或活動（URLGroup*）分組統計符合條件的短網址數及總點擊數（點擊數多到少），忽略 filter 的排序及分頁
+	ListURLGroups(ctx context.Context, filter URLFilter, by string) ([]models.GroupStat, error)
+	// ListURLHistory 取得目標網址修改紀錄（新到舊）
+	ListURLHistory(ctx context.Context, urlID uuid.UUID) ([]models.URLHistory, error)
+
+	// GetLinkPreview 取得快取的 Open Graph 信息，不存在時返回 ErrNotFound
+	GetLinkPreview(ctx context.Context, urlID uuid.UUID) (*models.LinkPreview, error)
+	// SaveLinkPreview 儲存（覆蓋）Open Graph 信息
+	SaveLinkPreview(ctx context.Context, preview *models.LinkPreview) error
+
+	// CreateAPIKey 建立 API 金鑰
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	// GetAPIKey 依 ID 查詢 API 金鑰，不存在時返回 ErrNotFound
+	GetAPIKey(ctx context.Context, id uuid.UUID) (*models.APIKey, error)
+	// GetAPIKeyByHash 依雜湊值查詢 API 金鑰，不存在時返回 ErrNotFound
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	// ListAPIKeys 取得使用者的所有 API 金鑰（新到舊），userID 為 nil 時返回所有使用者的金鑰
+	ListAPIKeys(ctx context.Context, userID *uuid.UUID) ([]models.APIKey, error)
+	// RevokeAPIKey 撤銷 API 金鑰
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
+
+	// RecordClick 記錄一次點擊
+	RecordClick(ctx context.Context, click *models.Click) error
+	// RecordClicks 批次記錄點擊
+	RecordClicks(ctx context.Context, clicks []models.Click) error
+	// 以下查詢的 includeBots 為 false 時排除爬蟲的點擊
+
+	// ListClicks 取得 [from, to) 內最近的 limit 筆點擊（新到舊）
+	ListClicks(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.Click, error)
+
+	// CountClicks 計算總點擊數（包含爬蟲，用於點擊次數上限）
+	CountClicks(ctx context.Context, urlID uuid.UUID) (int, error)
+	// UserAgentStats 依 User-Agent 分組統計 [from, to) 內的原始點擊（不使用彙總表，只在要求詳細統計時查詢）
+	UserAgentStats(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.DeviceStat, error)
+	// IPStats 依 IP 地址分組統計 [from, to) 內的原始點擊（不使用彙總表，只在要求詳細統計時查詢）
+	IPStats(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool, limit int) ([]models.IPStat, error)
+	// MinuteClicks 依分鐘分組統計 [from, to) 內的原始點擊數（只有 Bucket 及 Clicks，舊到新）
+	MinuteClicks(ctx context.Context, urlID uuid.UUID, from, to time.Time, includeBots bool) ([]ClickRollup, error)
+
+	// ClickGroups 依點擊時間的小時及彙總維度分組範圍內的原始點擊
+	ClickGroups(ctx context.Context, scope ClickScope) ([]ClickGroup, error)
+	// ClickRollupWatermark 取得彙總進度：寫入時間早於此時間的點擊已計入彙總表
+	ClickRollupWatermark(ctx context.Context) (time.Time, error)
+	// SaveClickRollups 累加寫入時間在 [from, until) 的點擊的每小時彙總及訪客 sketch（同時合併到每日彙總）並將進度推進到 until
+	// 目前進度不是 from 時（其他程序已處理）返回 ErrRollupConflict 且不寫入
+	SaveClickRollups(ctx context.Context, rollups []ClickRollup, visitors []VisitorSketch, from, until time.Time) error
+	// ListClickRollups 取得短網址 [from, until) 的彙總（須為 UTC 整點）：完整的 UTC 日使用每日彙總，其餘使用每小時彙總
+	ListClickRollups(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]ClickRollup, error)
+	// HourlyClicks 取得短網址 [from, until) 的每小時點擊數（只有 Bucket 及 Clicks，舊到新）
+	HourlyClicks(ctx context.Context, urlID uuid.UUID, from, until time.Time, includeBots bool) ([]ClickRollup, error)
+
+	// ClickVisitors 依點擊時間的時間段（unit 為 time.Hour 或 time.Minute）及 A/B 測試目標去重範圍內原始點擊的訪客指紋，
+	// 沒有指紋的點擊（包括爬蟲）不計入
+	ClickVisitors(ctx context.Context, scope ClickScope, unit time.Duration) ([]ClickVisitor, error)
+	// ListVisitorSketches 取得短網址 [from, until) 的訪客 sketch（須為 UTC 整點）：完整的 UTC 日使用每日 sketch，其餘使用每小時 sketch
+	ListVisitorSketches(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]VisitorSketch, error)
+	// HourlyVisitors 取得短網址 [from, until) 的每小時訪客 sketch（每個 A/B 測試目標各一個）
+	HourlyVisitors(ctx context.Context, urlID uuid.UUID, from, until time.Time) ([]VisitorSketch, error)
+}
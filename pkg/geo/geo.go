@@ -0,0 +1,175 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound 查無此 IP 的地理位置資料
+var ErrNotFound = errors.New("ip location not found")
+
+// DefaultLanguage 地名的預設語言
+const DefaultLanguage = "zh-CN"
+
+// LocationDetails 詳細地理位置信息
+type LocationDetails struct {
+	Location    string // 簡化版本（用於向後兼容）
+	ISP         string
+	Hostname    string
+	Country     string
+	CountryCode string // ISO 3166-1 二位國家代碼
+	Region      string
+	City        string
+	Zip         string
+}
+
+// GeoResolver 查詢 IP 的地理位置
+type GeoResolver interface {
+	// Lookup 查詢地理位置（不含 hostname），查無資料時返回 ErrNotFound
+	Lookup(ctx context.Context, ip net.IP) (LocationDetails, error)
+}
+
+// Lookup 以指定的 resolver 查詢 IP 地理位置及 hostname，本地及私有 IP 不查詢，查詢失敗時返回「未知」
+func Lookup(ctx context.Context, resolver GeoResolver, ipAddress string) LocationDetails {
+	result := LookupLocation(ctx, resolver, ipAddress)
+	if result.Location != "本地" {
+		result.Hostname = LookupHostname(ctx, ipAddress)
+	}
+	return result
+}
+
+// LookupLocation 與 Lookup 相同但不進行反向 DNS 查詢，適合在請求中使用
+func LookupLocation(ctx context.Context, resolver GeoResolver, ipAddress string) LocationDetails {
+	result := LocationDetails{
+		Location: "未知",
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(ipAddress))
+	if ipAddress == "localhost" || (ip != nil && isLocalIP(ip)) {
+		result.Location = "本地"
+		return result
+	}
+	if ip == nil || resolver == nil {
+		return result
+	}
+
+	details, err := resolver.Lookup(ctx, ip)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Error fetching IP location: %v", err)
+		}
+		return result
+	}
+
+	details.Location = formatLocation(details.Country, details.Region, details.City)
+	return details
+}
+
+// isLocalIP 檢查是否為本地或私有 IP
+func isLocalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// formatLocation 構建地理位置字符串（用於向後兼容）
+func formatLocation(country, region, city string) string {
+	parts := []string{}
+	if country != "" {
+		parts = append(parts, country)
+	}
+	if region != "" && region != country {
+		parts = append(parts, region)
+	}
+	if city != "" {
+		parts = append(parts, city)
+	}
+
+	if len(parts) == 0 {
+		return "未知"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// LookupHostname 反向 DNS 查詢 hostname，設置較短的超時避免拖慢查詢
+func LookupHostname(ctx context.Context, ipAddress string) string {
+	ip := net.ParseIP(strings.TrimSpace(ipAddress))
+	if ip == nil || isLocalIP(ip) {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	hostnames, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil || len(hostnames) == 0 {
+		return ""
+	}
+	// 移除末尾的點
+	return strings.TrimSuffix(hostnames[0], ".")
+}
+
+// Chain 依序嘗試多個 resolver，返回第一個成功的結果
+type Chain []GeoResolver
+
+// Lookup 依序查詢，全部失敗時返回最後一個錯誤
+func (c Chain) Lookup(ctx context.Context, ip net.IP) (LocationDetails, error) {
+	err := ErrNotFound
+	for _, resolver := range c {
+		var details LocationDetails
+		details, err = resolver.Lookup(ctx, ip)
+		if err == nil {
+			return details, nil
+		}
+	}
+	return LocationDetails{}, err
+}
+
+// NewFromEnv 依環境變數建立 resolver
+//
+// GEOIP_DB_PATH 指定 MMDB 檔案（MaxMind GeoLite2/GeoIP2 或 DB-IP，可用逗號分隔多個，
+// 例如 City 及 ASN 資料庫），檔案更新時自動重新載入；GEOIP_IPAPI 控制是否使用 ip-api.com，
+// 未設定 MMDB 時預設使用，設定了 MMDB 時預設不使用（設為 true 則作為備援）。
+// 返回的 close 函數用於停止檔案監看。
+func NewFromEnv() (GeoResolver, func(), error) {
+	language := os.Getenv("GEOIP_LANGUAGE")
+	if language == "" {
+		language = DefaultLanguage
+	}
+
+	var chain Chain
+	closeFn := func() {}
+
+	var paths []string
+	for _, path := range strings.Split(os.Getenv("GEOIP_DB_PATH"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) > 0 {
+		interval := DefaultReloadInterval
+		if d, err := time.ParseDuration(os.Getenv("GEOIP_RELOAD_INTERVAL")); err == nil && d > 0 {
+			interval = d
+		}
+		mmdb, err := NewMMDBResolver(paths, language, interval)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, mmdb)
+		closeFn = mmdb.Close
+	}
+
+	useIPAPI := len(paths) == 0
+	if v := os.Getenv("GEOIP_IPAPI"); v != "" {
+		useIPAPI = v == "true"
+	}
+	if useIPAPI {
+		chain = append(chain, NewIPAPIResolver(language))
+	}
+
+	return chain, closeFn, nil
+}
@@ -0,0 +1,80 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IPLocation ip-api.com 返回的地理位置信息
+type IPLocation struct {
+	Status      string `json:"status"`
+	Country     string `json:"country"`
+	Region      string `json:"regionName"`
+	City        string `json:"city"`
+	ISP         string `json:"isp"`
+	CountryCode string `json:"countryCode"`
+	Query       string `json:"query"`
+	Zip         string `json:"zip"`
+	Org         string `json:"org"`
+	AS          string `json:"as"`
+}
+
+// IPAPIResolver 使用 ip-api.com 免費 API 查詢（無需 API key，但有速率限制且只支援 HTTP）
+type IPAPIResolver struct {
+	client   *http.Client
+	language string
+}
+
+// NewIPAPIResolver 建立 ip-api.com resolver
+func NewIPAPIResolver(language string) *IPAPIResolver {
+	return &IPAPIResolver{
+		client: &http.Client{
+			Timeout: 2 * time.Second, // 設置超時，避免阻塞
+		},
+		language: language,
+	}
+}
+
+// Lookup 查詢 IP 地理位置
+func (r *IPAPIResolver) Lookup(ctx context.Context, ip net.IP) (LocationDetails, error) {
+	// 添加更多字段：zip, org, as (用於hostname)
+	apiURL := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,country,regionName,city,isp,countryCode,zip,org,as,query&lang=%s", ip, r.language)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return LocationDetails{}, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return LocationDetails{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return LocationDetails{}, fmt.Errorf("ip-api returned status %d", resp.StatusCode)
+	}
+
+	var location IPLocation
+	if err := json.NewDecoder(resp.Body).Decode(&location); err != nil {
+		return LocationDetails{}, fmt.Errorf("error parsing IP location: %w", err)
+	}
+
+	// 檢查API返回狀態
+	if location.Status != "success" {
+		return LocationDetails{}, ErrNotFound
+	}
+
+	return LocationDetails{
+		ISP:         location.ISP,
+		Country:     location.Country,
+		CountryCode: location.CountryCode,
+		Region:      location.Region,
+		City:        location.City,
+		Zip:         location.Zip,
+	}, nil
+}
@@ -0,0 +1,217 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DefaultReloadInterval 檢查 MMDB 檔案是否更新的預設間隔
+const DefaultReloadInterval = time.Minute
+
+// mmdbRecord 同時相容 City 及 ISP/ASN 資料庫的欄位，資料庫中沒有的欄位保持空值
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	ISP          string `maxminddb:"isp"`
+	ASNOrg       string `maxminddb:"autonomous_system_organization"`
+	Organization string `maxminddb:"organization"`
+}
+
+// mmdbFile 單一 MMDB 檔案及其載入時的檔案狀態
+type mmdbFile struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// MMDBResolver 從本地 MMDB 檔案查詢，檔案更新時自動重新載入
+type MMDBResolver struct {
+	language string
+
+	mu    sync.RWMutex
+	files []*mmdbFile
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewMMDBResolver 開啟 MMDB 檔案，interval 大於 0 時定期檢查檔案是否更新
+func NewMMDBResolver(paths []string, language string, interval time.Duration) (*MMDBResolver, error) {
+	r := &MMDBResolver{
+		language: language,
+		stop:     make(chan struct{}),
+	}
+
+	for _, path := range paths {
+		file, err := openMMDB(path)
+		if err != nil {
+			r.closeFiles()
+			return nil, err
+		}
+		r.files = append(r.files, file)
+	}
+
+	if interval > 0 {
+		go r.watch(interval)
+	}
+	return r, nil
+}
+
+// openMMDB 開啟 MMDB 檔案
+func openMMDB(path string) (*mmdbFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat GeoIP database %s: %w", path, err)
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %w", path, err)
+	}
+
+	log.Printf("GeoIP database loaded - Path: %s, Type: %s, Build: %s", path,
+		reader.Metadata.DatabaseType, time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format(time.RFC3339))
+	return &mmdbFile{
+		path:    path,
+		reader:  reader,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
+
+// Lookup 依序查詢所有檔案並合併結果，所有檔案都查無資料時返回 ErrNotFound
+func (r *MMDBResolver) Lookup(ctx context.Context, ip net.IP) (LocationDetails, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var record mmdbRecord
+	found := false
+	for _, file := range r.files {
+		_, ok, err := file.reader.LookupNetwork(ip, &record)
+		if err != nil {
+			return LocationDetails{}, fmt.Errorf("failed to look up %s in %s: %w", ip, file.path, err)
+		}
+		found = found || ok
+	}
+	if !found {
+		return LocationDetails{}, ErrNotFound
+	}
+
+	details := LocationDetails{
+		ISP:         firstNonEmpty(record.ISP, record.ASNOrg, record.Organization),
+		Country:     r.name(record.Country.Names),
+		CountryCode: record.Country.ISOCode,
+		City:        r.name(record.City.Names),
+		Zip:         record.Postal.Code,
+	}
+	if len(record.Subdivisions) > 0 {
+		details.Region = r.name(record.Subdivisions[0].Names)
+	}
+	return details, nil
+}
+
+// name 取得指定語言的地名，沒有時使用英文
+func (r *MMDBResolver) name(names map[string]string) string {
+	if name := names[r.language]; name != "" {
+		return name
+	}
+	return names["en"]
+}
+
+// watch 定期檢查檔案修改時間及大小，有變更時重新載入
+func (r *MMDBResolver) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.reloadChanged()
+		}
+	}
+}
+
+// reloadChanged 重新載入已變更的檔案，載入失敗時繼續使用舊檔案
+func (r *MMDBResolver) reloadChanged() {
+	r.mu.RLock()
+	files := append([]*mmdbFile(nil), r.files...)
+	r.mu.RUnlock()
+
+	for i, file := range files {
+		info, err := os.Stat(file.path)
+		if err != nil {
+			log.Printf("Error checking GeoIP database %s: %v", file.path, err)
+			continue
+		}
+		if info.ModTime().Equal(file.modTime) && info.Size() == file.size {
+			continue
+		}
+
+		reloaded, err := openMMDB(file.path)
+		if err != nil {
+			// 檔案可能還在寫入中，下次再試
+			log.Printf("Error reloading GeoIP database: %v", err)
+			continue
+		}
+
+		// 等待進行中的查詢結束後才關閉舊檔案
+		r.mu.Lock()
+		if i >= len(r.files) || r.files[i] != file {
+			// 已經關閉
+			r.mu.Unlock()
+			reloaded.reader.Close()
+			return
+		}
+		r.files[i] = reloaded
+		r.mu.Unlock()
+		file.reader.Close()
+	}
+}
+
+// Close 停止監看並關閉所有檔案
+func (r *MMDBResolver) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.closeFiles()
+	})
+}
+
+// closeFiles 關閉所有已開啟的檔案
+func (r *MMDBResolver) closeFiles() {
+	for _, file := range r.files {
+		file.reader.Close()
+	}
+	r.files = nil
+}
+
+// firstNonEmpty 返回第一個非空字串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
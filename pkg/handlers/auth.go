@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// apiKeyPrefix API 金鑰明文前綴
+	apiKeyPrefix = "sk_"
+
+	localsUserID = "auth_user_id"
+	localsAdmin  = "auth_admin"
+)
+
+// generateAPIKey 產生新的 API 金鑰明文
+func generateAPIKey() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(bytes), nil
+}
+
+// hashAPIKey 計算 API 金鑰的 SHA-256 雜湊值（金鑰本身為高熵隨機值，不需要慢雜湊）
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// extractAPIKey 從 Authorization: Bearer 或 X-API-Key 頭取得金鑰
+func extractAPIKey(c *fiber.Ctx) string {
+	if auth := c.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(c.Get("X-API-Key"))
+}
+
+// isAdminToken 檢查是否為 ADMIN_TOKEN 環境變數設定的管理員令牌
+func isAdminToken(token string) bool {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// Authenticate 解析請求中的 API 金鑰（可選），帶了無效金鑰時返回 401
+func (h *Handler) Authenticate(c *fiber.Ctx) error {
+	token := extractAPIKey(c)
+	if token == "" {
+		return c.Next()
+	}
+
+	if isAdminToken(token) {
+		c.Locals(localsAdmin, true)
+		return c.Next()
+	}
+
+	key, err := h.store.GetAPIKeyByHash(c.UserContext(), hashAPIKey(token))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Invalid API key",
+			})
+		}
+		log.Printf("Error querying API key: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if key.RevokedAt != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "API key has been revoked",
+		})
+	}
+
+	c.Locals(localsUserID, key.UserID)
+	return c.Next()
+}
+
+// RequireAuth 要求請求已通過 Authenticate 認證（API 金鑰或管理員令牌）
+func RequireAuth(c *fiber.Ctx) error {
+	if currentUserID(c) == nil && !isAdmin(c) {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "API key required",
+		})
+	}
+	return c.Next()
+}
+
+// currentUserID 取得目前認證的使用者 ID，未認證時返回 nil
+func currentUserID(c *fiber.Ctx) *uuid.UUID {
+	if userID, ok := c.Locals(localsUserID).(uuid.UUID); ok {
+		return &userID
+	}
+	return nil
+}
+
+// isAdmin 檢查目前請求是否使用管理員令牌
+func isAdmin(c *fiber.Ctx) bool {
+	admin, _ := c.Locals(localsAdmin).(bool)
+	return admin
+}
+
+// ownsLink 檢查目前使用者是否擁有該短網址（管理員擁有所有短網址）
+func ownsLink(c *fiber.Ctx, link *models.URL) bool {
+	if isAdmin(c) {
+		return true
+	}
+	userID := currentUserID(c)
+	return userID != nil && link.UserID != nil && *userID == *link.UserID
+}
+
+// canViewStats 檢查目前請求是否可查看統計：匿名建立的短網址公開，其餘只限擁有者
+func canViewStats(c *fiber.Ctx, link *models.URL) bool {
+	return link.UserID == nil || ownsLink(c, link)
+}
+
+// respondForbidden 返回未認證（401）或無權限（403）的回應
+func respondForbidden(c *fiber.Ctx) error {
+	if currentUserID(c) == nil && !isAdmin(c) {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "API key required",
+		})
+	}
+	return c.Status(403).JSON(fiber.Map{
+		"error": "You do not own this short URL",
+	})
+}
+
+// CreateAPIKey 建立 API 金鑰：使用者為自己建立，管理員可為指定或新的使用者建立
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	var req models.CreateAPIKeyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	var userID uuid.UUID
+	switch {
+	case isAdmin(c) && req.UserID != nil:
+		userID = *req.UserID
+	case isAdmin(c):
+		userID = uuid.New()
+	case currentUserID(c) != nil:
+		userID = *currentUserID(c)
+		if req.UserID != nil && *req.UserID != userID {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "Cannot create API keys for other users",
+			})
+		}
+	default:
+		return c.Status(401).JSON(fiber.Map{
+			"error": "API key required",
+		})
+	}
+
+	plainKey, err := generateAPIKey()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to generate API key",
+		})
+	}
+
+	key := models.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    plainKey[:len(apiKeyPrefix)+8],
+		KeyHash:   hashAPIKey(plainKey),
+		CreatedAt: time.Now(),
+	}
+	if err := h.store.CreateAPIKey(c.UserContext(), &key); err != nil {
+		log.Printf("Error creating API key: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	log.Printf("API key created - ID: %s, UserID: %s", key.ID, key.UserID)
+	return c.Status(201).JSON(models.CreateAPIKeyResponse{
+		APIKey: key,
+		Key:    plainKey,
+	})
+}
+
+// ListAPIKeys 列出目前使用者的 API 金鑰，管理員預設列出所有金鑰，可用 owner 指定使用者
+func (h *Handler) ListAPIKeys(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	if userID == nil && !isAdmin(c) {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "API key required",
+		})
+	}
+
+	if owner := c.Query("owner"); owner != "" {
+		ownerID, err := uuid.Parse(owner)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "owner must be a user ID",
+			})
+		}
+		if !isAdmin(c) && *userID != ownerID {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "Cannot list API keys of other users",
+			})
+		}
+		userID = &ownerID
+	}
+
+	keys, err := h.store.ListAPIKeys(c.UserContext(), userID)
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+
+	return c.JSON(fiber.Map{
+		"keys": keys,
+	})
+}
+
+// RevokeAPIKey 撤銷 API 金鑰，使用者只能撤銷自己的金鑰
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid API key ID",
+		})
+	}
+
+	ctx := c.UserContext()
+
+	key, err := h.store.GetAPIKey(ctx, id)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		log.Printf("Error querying API key: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	userID := currentUserID(c)
+	if key == nil || (!isAdmin(c) && (userID == nil || *userID != key.UserID)) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+
+	if err := h.store.RevokeAPIKey(ctx, id); err != nil {
+		log.Printf("Error revoking API key: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	log.Printf("API key revoked - ID: %s, UserID: %s", key.ID, key.UserID)
+	return c.SendStatus(204)
+}
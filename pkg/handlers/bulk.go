@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultBulkMaxRows = 20000
+
+	bulkStatusCreated = "created"
+	bulkStatusFailed  = "failed"
+	bulkStatusSkipped = "skipped"
+
+	bulkModePartial = "partial"
+	bulkModeAtomic  = "atomic"
+
+	bulkFormatJSON = "json"
+	bulkFormatCSV  = "csv"
+)
+
+// bulkReportColumns CSV 報告的欄位
+var bulkReportColumns = []string{"row", "url", "custom_code", "short_code", "short_url", "status", "error"}
+
+// bulkRow 批次輸入的一筆資料，err 為解析該筆時的錯誤
+type bulkRow struct {
+	req models.ShortenRequest
+	err error
+}
+
+// bulkMaxRows 每次批次建立的筆數上限，可透過 BULK_MAX_ROWS 調整
+func bulkMaxRows() int {
+	if n, err := strconv.Atoi(os.Getenv("BULK_MAX_ROWS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultBulkMaxRows
+}
+
+// isCSVRequest 檢查請求是否為 CSV 上傳（text/csv 或 multipart 表單）
+func isCSVRequest(c *fiber.Ctx) bool {
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	return strings.HasPrefix(contentType, "text/csv") || strings.HasPrefix(contentType, "application/csv") ||
+		strings.HasPrefix(contentType, fiber.MIMEMultipartForm)
+}
+
+// parseBulkRequest 解析 JSON 陣列或 CSV（請求內容或 multipart 表單的 file 欄位）
+func parseBulkRequest(c *fiber.Ctx) ([]bulkRow, error) {
+	if !isCSVRequest(c) {
+		var reqs []models.ShortenRequest
+		if err := json.Unmarshal(c.Body(), &reqs); err != nil {
+			return nil, errors.New("Invalid request body, expected a JSON array")
+		}
+		rows := make([]bulkRow, len(reqs))
+		for i := range reqs {
+			rows[i].req = reqs[i]
+		}
+		return rows, nil
+	}
+
+	if !strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), fiber.MIMEMultipartForm) {
+		return parseBulkCSV(strings.NewReader(string(c.Body())))
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.New("CSV file is required in the file field")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %v", err)
+	}
+	defer file.Close()
+	return parseBulkCSV(file)
+}
+
+// parseBulkCSV 解析帶標題列的 CSV，支援 url、custom_code、expires_at、max_clicks、active_from、tags（逗號分隔）、campaign 欄位，
+// 欄位名稱不分大小寫，其他欄位會被忽略，單筆的格式錯誤記錄在該筆的 err
+func parseBulkCSV(r io.Reader) ([]bulkRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV header row is required")
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		index[name] = i
+	}
+	if _, ok := index["url"]; !ok {
+		return nil, errors.New("CSV must have a url column")
+	}
+
+	var rows []bulkRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var row bulkRow
+		row.req.URL = field("url")
+		row.req.CustomCode = field("custom_code")
+		row.req.Campaign = field("campaign")
+		if tags := field("tags"); tags != "" {
+			row.req.Tags = strings.Split(tags, ",")
+		}
+		row.req.ExpiresAt, row.err = parseBulkTime("expires_at", field("expires_at"))
+		if row.err == nil {
+			row.req.ActiveFrom, row.err = parseBulkTime("active_from", field("active_from"))
+		}
+		if value := field("max_clicks"); value != "" && row.err == nil {
+			maxClicks, err := strconv.Atoi(value)
+			if err != nil {
+				row.err = errors.New("max_clicks must be an integer")
+			}
+			row.req.MaxClicks = &maxClicks
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseBulkTime 解析 CSV 中的時間（RFC 3339 或 2006-01-02，日期視為 UTC 零時），空字串返回 nil
+func parseBulkTime(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be RFC 3339 or YYYY-MM-DD", name)
+}
+
+// BulkShortenURL 批次建立短網址，接受 JSON 陣列或 CSV 上傳
+// mode=partial（預設）逐筆建立並返回每筆結果，mode=atomic 在同一個交易中建立，任一筆失敗時全部不建立
+func (h *Handler) BulkShortenURL(c *fiber.Ctx) error {
+	if !canCreateLinks(c) {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "API key required",
+		})
+	}
+
+	mode := c.Query("mode", bulkModePartial)
+	if mode != bulkModePartial && mode != bulkModeAtomic {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "mode must be one of partial, atomic",
+		})
+	}
+
+	// 報告格式預設與輸入格式相同
+	format := bulkFormatJSON
+	if isCSVRequest(c) {
+		format = bulkFormatCSV
+	}
+	format = c.Query("format", format)
+	if format != bulkFormatJSON && format != bulkFormatCSV {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "format must be one of json, csv",
+		})
+	}
+
+	rows, err := parseBulkRequest(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if len(rows) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "No links provided",
+		})
+	}
+	if maxRows := bulkMaxRows(); len(rows) > maxRows {
+		return c.Status(413).JSON(fiber.Map{
+			"error": fmt.Sprintf("At most %d links can be created per request", maxRows),
+		})
+	}
+
+	// 先驗證所有資料
+	userID := currentUserID(c)
+	links := make([]*models.URL, len(rows))
+	results := make([]models.BulkShortenResult, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		results[i] = models.BulkShortenResult{Row: i + 1, URL: row.req.URL, CustomCode: row.req.CustomCode}
+		if row.err == nil {
+			links[i], row.err = newLinkFromRequest(&row.req, userID)
+		}
+		if row.err != nil {
+			results[i].Status = bulkStatusFailed
+			results[i].Error = row.err.Error()
+		}
+	}
+
+	ctx := c.UserContext()
+	status := 201
+	if mode == bulkModeAtomic {
+		status = h.createLinksAtomic(ctx, links, results)
+	} else {
+		h.createLinksPartial(ctx, links, results)
+	}
+
+	response := models.BulkShortenResponse{Total: len(results), Results: results}
+	baseURL := requestBaseURL(c)
+	for i, link := range links {
+		if results[i].Status == "" {
+			results[i].Status = bulkStatusCreated
+			results[i].ShortCode = link.ShortCode
+			results[i].ShortURL = newShortenResponse(link, baseURL).ShortURL
+		}
+		switch results[i].Status {
+		case bulkStatusCreated:
+			response.Created++
+		case bulkStatusFailed:
+			response.Failed++
+		}
+	}
+	if mode == bulkModePartial && response.Created == 0 {
+		status = 400
+	}
+	log.Printf("Bulk shorten - mode: %s, total: %d, created: %d, failed: %d", mode, response.Total, response.Created, response.Failed)
+
+	if format == bulkFormatCSV {
+		return sendBulkCSVReport(c, status, results)
+	}
+	return c.Status(status).JSON(response)
+}
+
+// createLinksPartial 逐筆建立通過驗證的短網址，失敗的記錄在該筆結果
+func (h *Handler) createLinksPartial(ctx context.Context, links []*models.URL, results []models.BulkShortenResult) {
+	for i, link := range links {
+		if link == nil {
+			continue
+		}
+		err := h.insertLink(ctx, link)
+		if err == nil {
+			continue
+		}
+
+		results[i].Status = bulkStatusFailed
+		if errors.Is(err, db.ErrShortCodeExists) && results[i].CustomCode != "" {
+			results[i].Error = "Custom code already exists"
+		} else {
+			log.Printf("Error inserting URL in bulk row %d: %v", i+1, err)
+			results[i].Error = "Failed to create short URL"
+		}
+	}
+}
+
+// createLinksAtomic 在同一個交易中建立所有短網址，返回 HTTP 狀態碼
+// 任一筆驗證失敗或寫入失敗時全部不建立，其他筆標記為 skipped
+func (h *Handler) createLinksAtomic(ctx context.Context, links []*models.URL, results []models.BulkShortenResult) int {
+	skipOthers := func() {
+		for i := range results {
+			if results[i].Status == "" {
+				results[i].Status = bulkStatusSkipped
+			}
+		}
+	}
+
+	for _, result := range results {
+		if result.Status == bulkStatusFailed {
+			skipOthers()
+			return 400
+		}
+	}
+
+	// 交易中無法重試衝突的短碼，先為未自訂短碼的資料產生短碼
+	for i, link := range links {
+		if link.ShortCode != "" {
+			continue
+		}
+		shortCode, err := h.codes.Generate(ctx)
+		if err != nil {
+			log.Printf("Error generating short code in bulk row %d: %v", i+1, err)
+			results[i].Status = bulkStatusFailed
+			results[i].Error = "Failed to generate short code"
+			skipOthers()
+			return 500
+		}
+		link.ShortCode = shortCode
+	}
+
+	err := h.store.CreateURLs(ctx, links)
+	if err == nil {
+		return 201
+	}
+
+	var batchErr *db.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index >= len(results) {
+		log.Printf("Error inserting URLs in bulk: %v", err)
+		for i := range results {
+			results[i].Status = bulkStatusFailed
+			results[i].Error = "Failed to create short URL"
+		}
+		return 500
+	}
+
+	result := &results[batchErr.Index]
+	result.Status = bulkStatusFailed
+	status := 409
+	switch {
+	case errors.Is(err, db.ErrShortCodeExists) && result.CustomCode != "":
+		result.Error = "Custom code already exists"
+	case errors.Is(err, db.ErrShortCodeExists):
+		result.Error = "Generated short code already exists, please retry"
+	default:
+		log.Printf("Error inserting URL in bulk row %d: %v", batchErr.Index+1, err)
+		result.Error = "Failed to create short URL"
+		status = 500
+	}
+	skipOthers()
+	return status
+}
+
+// sendBulkCSVReport 以 CSV 附件返回批次建立結果
+func sendBulkCSVReport(c *fiber.Ctx, status int, results []models.BulkShortenResult) error {
+	var report strings.Builder
+	writer := csv.NewWriter(&report)
+	writer.Write(bulkReportColumns)
+	for _, result := range results {
+		writer.Write([]string{
+			strconv.Itoa(result.Row), result.URL, result.CustomCode, result.ShortCode, result.ShortURL,
+			result.Status, result.Error,
+		})
+	}
+	writer.Flush()
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Attachment("bulk-shorten-report.csv")
+	return c.Status(status).SendString(report.String())
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/geo"
+	"go-shorturl/pkg/models"
+)
+
+// ClickQueue 非同步點擊佇列，Enqueue 不可阻塞，佇列已滿時返回 false
+type ClickQueue interface {
+	Enqueue(click models.Click) bool
+}
+
+// ClickEnricher 返回補充點擊記錄設備、操作系統及地理位置資訊的函數
+// 地理位置查詢可能需要呼叫外部 API，應在重定向請求之外執行
+func ClickEnricher(resolver geo.GeoResolver) func(click *models.Click) {
+	return func(click *models.Click) {
+		enrichClick(resolver, click)
+	}
+}
+
+// enrichClick 補充點擊記錄的設備、操作系統及地理位置資訊
+// 重定向時已查詢過地理位置（地理定向規則）的點擊只補充 hostname
+func enrichClick(resolver geo.GeoResolver, click *models.Click) {
+	click.DeviceType = parseDeviceType(click.UserAgent)
+	click.OS = parseOS(click.UserAgent)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if click.Location == "" {
+		setClickLocation(click, geo.Lookup(ctx, resolver, click.IPAddress))
+	} else if click.LocationHostname == "" {
+		click.LocationHostname = geo.LookupHostname(ctx, click.IPAddress)
+	}
+
+	if os.Getenv("DEBUG") == "true" {
+		log.Printf("Click enriched - IP: %s, Device: %s, OS: %s, Location: %s",
+			click.IPAddress, click.DeviceType, click.OS, click.Location)
+		log.Printf("Location Details - ISP: %s, Country: %s, Region: %s, City: %s, Zip: %s, Hostname: %s",
+			click.LocationISP, click.LocationCountry, click.LocationRegion, click.LocationCity, click.LocationZip, click.LocationHostname)
+	}
+}
+
+// setClickLocation 將地理位置資訊寫入點擊記錄
+func setClickLocation(click *models.Click, locationDetails geo.LocationDetails) {
+	click.Location = locationDetails.Location
+	click.LocationISP = locationDetails.ISP
+	click.LocationHostname = locationDetails.Hostname
+	click.LocationCountry = locationDetails.Country
+	click.LocationRegion = locationDetails.Region
+	click.LocationCity = locationDetails.City
+	click.LocationZip = locationDetails.Zip
+}
+
+// recordClick 記錄點擊：有設定佇列時交給背景處理，否則（例如 Serverless 環境）同步補充資訊並寫入
+func (h *Handler) recordClick(ctx context.Context, shortCode string, click models.Click) {
+	// Fiber 返回的請求標頭字串在請求結束後會被重用，保存前需複製
+	click.IPAddress = strings.Clone(click.IPAddress)
+	click.UserAgent = strings.Clone(click.UserAgent)
+	click.Referrer = strings.Clone(click.Referrer)
+
+	if click.ClickedAt.IsZero() {
+		click.ClickedAt = time.Now()
+	}
+	// 爬蟲不計入不重複訪客
+	if !click.IsBot {
+		click.VisitorHash = h.visitors.hash(click.IPAddress, click.UserAgent, click.ClickedAt)
+	}
+
+	if h.clicks != nil {
+		if !h.clicks.Enqueue(click) {
+			log.Printf("Click queue full, dropping click for short_code %s", shortCode)
+		}
+		return
+	}
+
+	enrichClick(h.geo, &click)
+	if err := h.store.RecordClick(ctx, &click); err != nil {
+		// 不返回錯誤，因為重定向仍然應該工作
+		log.Printf("Error recording click for short_code %s: %v", shortCode, err)
+		return
+	}
+
+	// 統計的時區由查詢參數決定，日誌統一使用 UTC
+	log.Printf("Click recorded - ShortCode: %s, Time (UTC): %s",
+		shortCode, click.ClickedAt.UTC().Format("2006-01-02 15:04:05"))
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"html/template"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"go-shorturl/pkg/botdetect"
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/geo"
+	"go-shorturl/pkg/shortcode"
+)
+
+// Handler 短網址 HTTP 處理器，所有資料存取都透過注入的 Store
+type Handler struct {
+	store    db.Store
+	codes    shortcode.Generator
+	clicks   ClickQueue
+	geo      geo.GeoResolver
+	preview  *template.Template
+	previews *previewCache
+	unlock   *unlockGuard
+	visitors *visitorHasher
+	bots     *botdetect.Detector
+}
+
+// Option 處理器設定選項
+type Option func(*Handler)
+
+// WithCodeGenerator 指定自動產生短碼的產生器
+func WithCodeGenerator(codes shortcode.Generator) Option {
+	return func(h *Handler) {
+		h.codes = codes
+	}
+}
+
+// WithClickQueue 指定非同步點擊佇列，未指定時在重定向請求中同步記錄點擊
+func WithClickQueue(clicks ClickQueue) Option {
+	return func(h *Handler) {
+		h.clicks = clicks
+	}
+}
+
+// WithGeoResolver 指定 IP 地理位置查詢方式
+func WithGeoResolver(resolver geo.GeoResolver) Option {
+	return func(h *Handler) {
+		h.geo = resolver
+	}
+}
+
+// WithPreviewTemplate 指定社交媒體爬蟲預覽頁面的模板
+func WithPreviewTemplate(tmpl *template.Template) Option {
+	return func(h *Handler) {
+		h.preview = tmpl
+	}
+}
+
+// WithBotDetector 指定爬蟲判斷器（通常由 botdetect.NewFromEnv 建立），未指定時只依 User-Agent 及請求方式判斷
+func WithBotDetector(bots *botdetect.Detector) Option {
+	return func(h *Handler) {
+		h.bots = bots
+	}
+}
+
+// New 以指定的 Store 建立處理器，未指定的依賴使用預設值
+func New(store db.Store, opts ...Option) *Handler {
+	h := &Handler{
+		store:    store,
+		previews: previewCacheFromEnv(store),
+		unlock:   unlockGuardFromEnv(),
+		visitors: visitorHasherFromEnv(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.codes == nil {
+		codes, err := shortcode.New(shortcode.Config{}, store)
+		if err != nil {
+			log.Fatalf("Failed to create default short code generator: %v", err)
+		}
+		h.codes = codes
+	}
+	if h.geo == nil {
+		h.geo = geo.NewIPAPIResolver(geo.DefaultLanguage)
+	}
+	if h.preview == nil {
+		h.preview = previewTemplateFromEnv()
+	}
+	if h.bots == nil {
+		h.bots = botdetect.New(nil)
+	}
+	return h
+}
+
+var (
+	randomSecretsMu sync.Mutex
+	randomSecrets   = make(map[string][]byte)
+)
+
+// secretFromEnv 讀取環境變數中的金鑰，未設定時記錄錯誤並使用程序內共用的隨機金鑰
+// 隨機金鑰在重新啟動後改變，多個實例（包括 Vercel）之間也不一致，正式環境必須設定
+func secretFromEnv(name string) []byte {
+	if value := os.Getenv(name); value != "" {
+		return []byte(value)
+	}
+
+	randomSecretsMu.Lock()
+	defer randomSecretsMu.Unlock()
+	if key, ok := randomSecrets[name]; ok {
+		return key
+	}
+	log.Printf("ERROR: %s is not set, using a random key that only this process knows; set %s in production (required on Vercel)", name, name)
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Failed to generate %s: %v", name, err)
+	}
+	randomSecrets[name] = key
+	return key
+}
+
+// TrustedProxiesFromEnv 讀取 TRUSTED_PROXIES（逗號分隔的 IP 或 CIDR）
+// 設定後只有來自這些位址的請求才採用 X-Forwarded-For，其他請求使用連線的來源 IP
+func TrustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/geo"
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// stubResolver 測試用的地理位置查詢，一律查無資料，避免呼叫外部 API
+type stubResolver struct{}
+
+func (stubResolver) Lookup(ctx context.Context, ip net.IP) (geo.LocationDetails, error) {
+	return geo.LocationDetails{}, geo.ErrNotFound
+}
+
+// newTestApp 以 MemoryStore 建立測試用的應用程式（點擊同步寫入）
+func newTestApp() *fiber.App {
+	h := New(db.NewMemoryStore(), WithGeoResolver(stubResolver{}))
+
+	app := fiber.New(fiber.Config{
+		ProxyHeader:        "X-Forwarded-For",
+		EnableIPValidation: true,
+	})
+	api := app.Group("/api", h.Authenticate)
+	api.Post("/shorten", h.ShortenURL)
+	api.Get("/stats/:short_code", h.GetStats)
+	api.Patch("/links/:short_code", h.UpdateLink)
+	api.Post("/keys", RequireAuth, h.CreateAPIKey)
+	api.Get("/keys", RequireAuth, h.ListAPIKeys)
+	app.Get("/url/:short_code/*", h.RedirectURL)
+	app.Post("/url/:short_code/*", h.UnlockURL)
+	return app
+}
+
+// doRequest 發送請求並返回狀態碼、回應標頭及內容
+func doRequest(t *testing.T, app *fiber.App, method, path, body string, headers map[string]string) (int, map[string][]string, []byte) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: reading body: %v", method, path, err)
+	}
+	return resp.StatusCode, resp.Header, data
+}
+
+func TestShortenRedirectStats(t *testing.T) {
+	app := newTestApp()
+
+	status, _, body := doRequest(t, app, "POST", "/api/shorten", `{"url":"https://example.com/page"}`, nil)
+	if status != 201 {
+		t.Fatalf("shorten: status %d, body %s", status, body)
+	}
+	var shortened models.ShortenResponse
+	if err := json.Unmarshal(body, &shortened); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if shortened.ShortCode == "" {
+		t.Fatalf("shorten: empty short code in %s", body)
+	}
+
+	visitors := []map[string]string{
+		{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X)", "X-Forwarded-For": "192.168.1.10"},
+		{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X)", "X-Forwarded-For": "192.168.1.10"},
+		{"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "X-Forwarded-For": "192.168.1.11"},
+	}
+	for _, headers := range visitors {
+		status, header, body := doRequest(t, app, "GET", "/url/"+shortened.ShortCode, "", headers)
+		if status != 302 {
+			t.Fatalf("redirect: status %d, body %s", status, body)
+		}
+		if got := header["Location"]; len(got) != 1 || got[0] != "https://example.com/page" {
+			t.Fatalf("redirect: Location %v", got)
+		}
+	}
+
+	status, _, body = doRequest(t, app, "GET", "/url/missing", "", nil)
+	if status != 404 {
+		t.Fatalf("redirect missing: status %d, body %s", status, body)
+	}
+
+	status, _, body = doRequest(t, app, "GET", "/api/stats/"+shortened.ShortCode, "", nil)
+	if status != 200 {
+		t.Fatalf("stats: status %d, body %s", status, body)
+	}
+	var stats models.StatsResponse
+	if err := json.Unmarshal(body, &stats); err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.TotalClicks != 3 {
+		t.Errorf("total_clicks = %d, want 3", stats.TotalClicks)
+	}
+	if stats.UniqueVisitors != 2 {
+		t.Errorf("unique_visitors = %d, want 2", stats.UniqueVisitors)
+	}
+	devices := make(map[string]int)
+	for _, stat := range stats.DeviceTypeStats {
+		devices[stat.DeviceType] = stat.Count
+	}
+	if devices["iPhone"] != 2 {
+		t.Errorf("device_type_stats = %+v, want 2 iPhone clicks", stats.DeviceTypeStats)
+	}
+}
+
+func TestShortenChecksAuthBeforeValidation(t *testing.T) {
+	t.Setenv("REQUIRE_API_KEY", "true")
+	app := newTestApp()
+
+	status, _, body := doRequest(t, app, "POST", "/api/shorten", `{"url":"not a url"}`, nil)
+	if status != 401 {
+		t.Fatalf("status %d, body %s, want 401", status, body)
+	}
+}
+
+func TestListAPIKeys(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	app := newTestApp()
+	admin := map[string]string{"X-API-Key": "admin-token"}
+
+	// 管理員為兩個新使用者各建立一把金鑰
+	var created []models.CreateAPIKeyResponse
+	for _, name := range []string{"alice", "bob"} {
+		status, _, body := doRequest(t, app, "POST", "/api/keys", fmt.Sprintf(`{"name":%q}`, name), admin)
+		if status != 201 {
+			t.Fatalf("create key %s: status %d, body %s", name, status, body)
+		}
+		var key models.CreateAPIKeyResponse
+		if err := json.Unmarshal(body, &key); err != nil {
+			t.Fatalf("create key %s: %v", name, err)
+		}
+		created = append(created, key)
+	}
+	alice, bob := created[0], created[1]
+
+	listKeys := func(path string, headers map[string]string) (int, []models.APIKey) {
+		t.Helper()
+		status, _, body := doRequest(t, app, "GET", path, "", headers)
+		var resp struct {
+			Keys []models.APIKey `json:"keys"`
+		}
+		if status == 200 {
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+		}
+		return status, resp.Keys
+	}
+
+	if status, keys := listKeys("/api/keys", admin); status != 200 || len(keys) != 2 {
+		t.Errorf("admin list: status %d, %d keys, want 200 with 2 keys", status, len(keys))
+	}
+	status, keys := listKeys("/api/keys?owner="+bob.UserID.String(), admin)
+	if status != 200 || len(keys) != 1 || keys[0].ID != bob.ID {
+		t.Errorf("admin list by owner: status %d, keys %+v, want only bob's key", status, keys)
+	}
+	if status, _ := listKeys("/api/keys?owner=nobody", admin); status != 400 {
+		t.Errorf("admin list with invalid owner: status %d, want 400", status)
+	}
+
+	aliceHeaders := map[string]string{"X-API-Key": alice.Key}
+	status, keys = listKeys("/api/keys", aliceHeaders)
+	if status != 200 || len(keys) != 1 || keys[0].ID != alice.ID {
+		t.Errorf("user list: status %d, keys %+v, want only alice's key", status, keys)
+	}
+	if status, _ := listKeys("/api/keys?owner="+bob.UserID.String(), aliceHeaders); status != 403 {
+		t.Errorf("user listing other user's keys: status %d, want 403", status)
+	}
+	if status, _ := listKeys("/api/keys", nil); status != 401 {
+		t.Errorf("anonymous list: status %d, want 401", status)
+	}
+}
+
+func TestUnlockLimitsAttempts(t *testing.T) {
+	t.Setenv("UNLOCK_MAX_ATTEMPTS", "2")
+	t.Setenv("UNLOCK_LINK_MAX_ATTEMPTS", "3")
+	app := newTestApp()
+
+	status, _, body := doRequest(t, app, "POST", "/api/shorten", `{"url":"https://example.com","password":"secret"}`, nil)
+	if status != 201 {
+		t.Fatalf("shorten: status %d, body %s", status, body)
+	}
+	var shortened models.ShortenResponse
+	if err := json.Unmarshal(body, &shortened); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	unlock := func(ip, password string, headers map[string]string) int {
+		t.Helper()
+		req := map[string]string{"Content-Type": "application/x-www-form-urlencoded", "X-Forwarded-For": ip}
+		for k, v := range headers {
+			req[k] = v
+		}
+		status, _, _ := doRequest(t, app, "POST", "/url/"+shortened.ShortCode, "password="+password, req)
+		return status
+	}
+
+	steps := []struct {
+		ip       string
+		password string
+		headers  map[string]string
+		want     int
+	}{
+		{"203.0.113.1", "wrong", nil, 401},
+		{"203.0.113.1", "wrong", nil, 401},
+		{"203.0.113.1", "secret", nil, 429}, // 同一 IP 已達上限
+		{"203.0.113.1", "wrong", map[string]string{"X-Real-IP": "198.51.100.9"}, 429},
+		{"203.0.113.2", "secret", nil, 303}, // 密碼正確時退回整個短網址的嘗試次數
+		{"203.0.113.3", "wrong", nil, 401},
+		{"203.0.113.4", "wrong", nil, 429}, // 整個短網址已達上限
+		{"203.0.113.5", "secret", nil, 429},
+	}
+	for i, step := range steps {
+		if got := unlock(step.ip, step.password, step.headers); got != step.want {
+			t.Fatalf("step %d (%s): status %d, want %d", i, step.ip, got, step.want)
+		}
+	}
+}
+
+func TestLinkLimitKeepsIPAttempts(t *testing.T) {
+	t.Setenv("UNLOCK_MAX_ATTEMPTS", "2")
+	t.Setenv("UNLOCK_LINK_MAX_ATTEMPTS", "1")
+	store := db.NewMemoryStore()
+	h := New(store)
+	ctx := context.Background()
+	link := &models.URL{ID: uuid.New()}
+
+	steps := []struct {
+		ip   string
+		want bool
+	}{
+		{"203.0.113.1", true},
+		{"203.0.113.2", false}, // 整個短網址已達上限
+		{"203.0.113.2", false},
+		{"203.0.113.2", false},
+	}
+	for i, step := range steps {
+		allowed, err := h.reserveAttempt(ctx, link, step.ip)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if allowed != step.want {
+			t.Fatalf("step %d (%s): allowed %v, want %v", i, step.ip, allowed, step.want)
+		}
+	}
+
+	// 被整個短網址的限制拒絕的請求不佔用該 IP 的次數
+	since := time.Now().Add(-time.Hour)
+	if attempts, err := store.AddUnlockAttempts(ctx, unlockAttemptKey(link, "203.0.113.2"), 0, since); err != nil || attempts != 0 {
+		t.Errorf("IP attempts = %d, %v; want 0", attempts, err)
+	}
+}
+
+func TestUpdateLinkClearsSchedule(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+	app := newTestApp()
+	admin := map[string]string{"X-API-Key": "admin-token"}
+
+	now := time.Now().UTC()
+	create := fmt.Sprintf(`{"url":"https://example.com","max_clicks":1,"active_from":%q,"expires_at":%q}`,
+		now.Add(time.Hour).Format(time.RFC3339), now.Add(2*time.Hour).Format(time.RFC3339))
+	status, _, body := doRequest(t, app, "POST", "/api/shorten", create, nil)
+	if status != 201 {
+		t.Fatalf("shorten: status %d, body %s", status, body)
+	}
+	var shortened models.ShortenResponse
+	if err := json.Unmarshal(body, &shortened); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	path := "/api/links/" + shortened.ShortCode
+
+	if status, _, body := doRequest(t, app, "GET", "/url/"+shortened.ShortCode, "", nil); status != 503 {
+		t.Fatalf("before active_from: status %d, body %s", status, body)
+	}
+
+	status, _, body = doRequest(t, app, "PATCH", path, `{"max_clicks":5,"clear_max_clicks":true}`, admin)
+	if status != 400 {
+		t.Fatalf("conflicting clear flag: status %d, body %s, want 400", status, body)
+	}
+
+	status, _, body = doRequest(t, app, "PATCH", path, `{"clear_active_from":true,"clear_expires_at":true,"clear_max_clicks":true}`, admin)
+	if status != 200 {
+		t.Fatalf("clear: status %d, body %s", status, body)
+	}
+	var updated models.URL
+	if err := json.Unmarshal(body, &updated); err != nil {
+		t.Fatalf("clear: %v", err)
+	}
+	if updated.ActiveFrom != nil || updated.ExpiresAt != nil || updated.MaxClicks != nil {
+		t.Fatalf("clear: active_from %v, expires_at %v, max_clicks %v, want all unset", updated.ActiveFrom, updated.ExpiresAt, updated.MaxClicks)
+	}
+
+	// 點擊次數上限已清除，可超過原本的 1 次
+	for i := 0; i < 2; i++ {
+		if status, _, body := doRequest(t, app, "GET", "/url/"+shortened.ShortCode, "", nil); status != 302 {
+			t.Fatalf("redirect %d: status %d, body %s", i, status, body)
+		}
+	}
+
+	status, _, body = doRequest(t, app, "PATCH", path, `{"max_clicks":2}`, admin)
+	if status != 200 {
+		t.Fatalf("set max_clicks: status %d, body %s", status, body)
+	}
+	if status, _, body := doRequest(t, app, "GET", "/url/"+shortened.ShortCode, "", nil); status != 410 {
+		t.Fatalf("after max_clicks: status %d, body %s, want 410", status, body)
+	}
+}
+
+func TestStatsVariantsAndDetails(t *testing.T) {
+	app := newTestApp()
+
+	status, _, body := doRequest(t, app, "POST", "/api/shorten", `{"url":"https://example.com","variants":[{"name":"a","destination":"https://example.com/a","weight":1},{"name":"b","destination":"https://example.com/b","weight":1}]}`, nil)
+	if status != 201 {
+		t.Fatalf("shorten: status %d, body %s", status, body)
+	}
+	var shortened models.ShortenResponse
+	if err := json.Unmarshal(body, &shortened); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	for _, ip := range []string{"192.168.1.10", "192.168.1.10", "192.168.1.11"} {
+		headers := map[string]string{"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "X-Forwarded-For": ip}
+		if status, _, body := doRequest(t, app, "GET", "/url/"+shortened.ShortCode, "", headers); status != 302 {
+			t.Fatalf("redirect: status %d, body %s", status, body)
+		}
+	}
+
+	stats := func(query string) models.StatsResponse {
+		t.Helper()
+		status, _, body := doRequest(t, app, "GET", "/api/stats/"+shortened.ShortCode+query, "", nil)
+		if status != 200 {
+			t.Fatalf("stats%s: status %d, body %s", query, status, body)
+		}
+		var stats models.StatsResponse
+		if err := json.Unmarshal(body, &stats); err != nil {
+			t.Fatalf("stats%s: %v", query, err)
+		}
+		return stats
+	}
+
+	// 同一 IP 固定分配到同一目標，各目標的點擊數及訪客數加總即為整體數值
+	summary := stats("")
+	clicks, visitors := 0, 0
+	for _, stat := range summary.VariantStats {
+		clicks += stat.Count
+		visitors += stat.UniqueVisitors
+	}
+	if clicks != 3 || visitors != 2 {
+		t.Errorf("variant_stats = %+v, want 3 clicks from 2 visitors", summary.VariantStats)
+	}
+	if summary.IPStats != nil || summary.DeviceStats != nil {
+		t.Errorf("ip_stats %+v, device_stats %+v, want none without details", summary.IPStats, summary.DeviceStats)
+	}
+
+	detailed := stats("?details=true")
+	if len(detailed.IPStats) != 2 || len(detailed.DeviceStats) != 1 {
+		t.Errorf("ip_stats %+v, device_stats %+v, want 2 IPs and 1 User-Agent", detailed.IPStats, detailed.DeviceStats)
+	}
+}
+
+func TestBotClicksCountTowardMaxClicks(t *testing.T) {
+	app := newTestApp()
+
+	status, _, body := doRequest(t, app, "POST", "/api/shorten", `{"url":"https://example.com","max_clicks":2}`, nil)
+	if status != 201 {
+		t.Fatalf("shorten: status %d, body %s", status, body)
+	}
+	var shortened models.ShortenResponse
+	if err := json.Unmarshal(body, &shortened); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	steps := []struct {
+		userAgent string
+		want      int
+	}{
+		{"curl/8.4.0", 302},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64)", 302},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64)", 410}, // 爬蟲的點擊也計入上限
+	}
+	for i, step := range steps {
+		if status, _, body := doRequest(t, app, "GET", "/url/"+shortened.ShortCode, "", map[string]string{"User-Agent": step.userAgent}); status != step.want {
+			t.Fatalf("step %d: status %d, body %s, want %d", i, status, body, step.want)
+		}
+	}
+
+	status, _, body = doRequest(t, app, "GET", "/api/stats/"+shortened.ShortCode, "", nil)
+	if status != 200 {
+		t.Fatalf("stats: status %d, body %s", status, body)
+	}
+	var stats models.StatsResponse
+	if err := json.Unmarshal(body, &stats); err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.TotalClicks != 1 || stats.BotClicks != 1 || stats.RemainingClicks == nil || *stats.RemainingClicks != 0 || !stats.Expired {
+		t.Errorf("total_clicks %d, bot_clicks %d, remaining_clicks %v, expired %v, want 1, 1, 0, true",
+			stats.TotalClicks, stats.BotClicks, stats.RemainingClicks, stats.Expired)
+	}
+}
+
+func TestRedirectCacheControl(t *testing.T) {
+	app := newTestApp()
+
+	tests := []struct {
+		name    string
+		options string
+		noStore bool
+	}{
+		{"plain", ``, false},
+		{"rules", `,"rules":[{"name":"tw","countries":["TW"],"destination":"https://example.com/tw"}]`, true},
+		{"variants", `,"variants":[{"name":"a","destination":"https://example.com/a","weight":1},{"name":"b","destination":"https://example.com/b","weight":1}]`, true},
+		{"query passthrough", `,"query_passthrough":"preserve"`, true},
+		{"path forwarding", `,"path_forwarding":true`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := doRequest(t, app, "POST", "/api/shorten", `{"url":"https://example.com","redirect_status":301`+tt.options+`}`, nil)
+			if status != 201 {
+				t.Fatalf("shorten: status %d, body %s", status, body)
+			}
+			var shortened models.ShortenResponse
+			if err := json.Unmarshal(body, &shortened); err != nil {
+				t.Fatalf("shorten: %v", err)
+			}
+
+			status, header, body := doRequest(t, app, "GET", "/url/"+shortened.ShortCode, "", nil)
+			if status != 301 {
+				t.Fatalf("redirect: status %d, body %s", status, body)
+			}
+			cacheControl := strings.Join(header["Cache-Control"], ",")
+			if got := strings.Contains(cacheControl, "no-store"); got != tt.noStore {
+				t.Errorf("Cache-Control = %q, want no-store %v", cacheControl, tt.noStore)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLinkListLimit = 50
+	maxLinkListLimit     = 200
+	maxLinkSearchLength  = 200
+)
+
+// domainPattern 篩選用的網域名稱（小寫）
+var domainPattern = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)*$`)
+
+// errListOthersLinks 非管理員以 owner 指定其他使用者
+var errListOthersLinks = errors.New("You can only list your own links")
+
+// encodeLinkCursor 將最後一筆的排序值編碼為游標，游標記錄排序方式，換排序後不可沿用
+func encodeLinkCursor(filter db.URLFilter, link models.LinkSummary) string {
+	value := link.CreatedAt.UnixNano()
+	if filter.Sort == db.URLSortClicks {
+		value = int64(link.TotalClicks)
+	}
+	raw := fmt.Sprintf("%s|%t|%d|%s", filter.Sort, filter.Asc, value, link.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeLinkCursor 解析游標，排序方式與目前查詢不同時返回錯誤
+func decodeLinkCursor(filter db.URLFilter, cursor string) (*db.URLCursor, error) {
+	errInvalid := errors.New("Invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalid
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 || parts[0] != filter.Sort || parts[1] != strconv.FormatBool(filter.Asc) {
+		return nil, errInvalid
+	}
+	value, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, errInvalid
+	}
+	id, err := uuid.Parse(parts[3])
+	if err != nil {
+		return nil, errInvalid
+	}
+
+	after := &db.URLCursor{ID: id}
+	if filter.Sort == db.URLSortClicks {
+		after.Clicks = int(value)
+	} else {
+		after.CreatedAt = time.Unix(0, value).UTC()
+	}
+	return after, nil
+}
+
+// parseLinkFilter 從查詢參數建立列表條件，返回給使用者的錯誤訊息
+func parseLinkFilter(c *fiber.Ctx) (db.URLFilter, error) {
+	filter := db.URLFilter{
+		UserID: currentUserID(c),
+		Domain: strings.ToLower(strings.TrimSpace(c.Query("domain"))),
+		Status: c.Query("status"),
+		Search: strings.TrimSpace(c.Query("q")),
+		Tag:    c.Query("tag"),
+		Sort:   c.Query("sort", db.URLSortCreatedAt),
+		Limit:  defaultLinkListLimit,
+	}
+
+	// 管理員預設列出所有短網址，可用 owner 指定使用者；其他使用者只能列出自己的短網址
+	if owner := c.Query("owner"); owner != "" {
+		ownerID, err := uuid.Parse(owner)
+		if err != nil {
+			return filter, errors.New("owner must be a user ID")
+		}
+		if !isAdmin(c) && (filter.UserID == nil || *filter.UserID != ownerID) {
+			return filter, errListOthersLinks
+		}
+		filter.UserID = &ownerID
+	}
+
+	if filter.Domain != "" && !domainPattern.MatchString(filter.Domain) {
+		return filter, errors.New("Invalid domain")
+	}
+	switch filter.Status {
+	case "", db.URLStatusActive, db.URLStatusDisabled, db.URLStatusExpired, db.URLStatusScheduled, db.URLStatusDeleted:
+	default:
+		return filter, errors.New("status must be one of active, disabled, expired, scheduled, deleted")
+	}
+	if filter.Tag != "" {
+		tag, err := normalizeTag(filter.Tag)
+		if err != nil {
+			return filter, err
+		}
+		filter.Tag = tag
+	}
+	campaign, err := normalizeCampaign(c.Query("campaign"))
+	if err != nil {
+		return filter, err
+	}
+	filter.Campaign = campaign
+	if len(filter.Search) > maxLinkSearchLength {
+		return filter, fmt.Errorf("q must be at most %d characters", maxLinkSearchLength)
+	}
+	if filter.Sort != db.URLSortCreatedAt && filter.Sort != db.URLSortClicks {
+		return filter, errors.New("sort must be one of created_at, clicks")
+	}
+	switch c.Query("order", "desc") {
+	case "asc":
+		filter.Asc = true
+	case "desc":
+	default:
+		return filter, errors.New("order must be one of asc, desc")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLinkListLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxLinkListLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeLinkCursor(filter, cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = after
+	}
+	return filter, nil
+}
+
+// respondLinkFilterError 將 parseLinkFilter 的錯誤轉換為 HTTP 回應
+func respondLinkFilterError(c *fiber.Ctx, err error) error {
+	status := 400
+	if errors.Is(err, errListOthersLinks) {
+		status = 403
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// ListLinks 列出短網址及其總點擊數，支援篩選、搜尋、排序及游標分頁（需認證）
+func (h *Handler) ListLinks(c *fiber.Ctx) error {
+	filter, err := parseLinkFilter(c)
+	if err != nil {
+		return respondLinkFilterError(c, err)
+	}
+
+	// 多取一筆判斷是否還有下一頁
+	limit := filter.Limit
+	filter.Limit++
+	links, err := h.store.ListURLs(c.UserContext(), filter)
+	if err != nil {
+		log.Printf("Error listing URLs: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	response := models.LinkListResponse{Links: links}
+	if len(links) > limit {
+		response.Links = links[:limit]
+		response.NextCursor = encodeLinkCursor(filter, response.Links[limit-1])
+	}
+	if response.Links == nil {
+		response.Links = []models.LinkSummary{}
+	}
+
+	baseURL := requestBaseURL(c)
+	for i := range response.Links {
+		response.Links[i].ShortURL = newShortenResponse(&response.Links[i].URL, baseURL).ShortURL
+	}
+	return c.JSON(response)
+}
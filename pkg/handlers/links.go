@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// respondLookupError 將查詢短網址的錯誤轉換為 HTTP 回應
+func respondLookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, db.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Short URL not found",
+		})
+	}
+	log.Printf("Error querying URL: %v", err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "Database error",
+	})
+}
+
+// derefString 取得字串指標的值，nil 時返回空字串
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// GetLink 取得短網址詳情（包含已停用或已刪除的短網址）
+func (h *Handler) GetLink(c *fiber.Ctx) error {
+	shortCode := c.Params("short_code")
+	if shortCode == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	link, err := h.store.GetURLByShortCode(c.UserContext(), shortCode)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+	if !canViewStats(c, link) {
+		return respondForbidden(c)
+	}
+
+	return c.JSON(link)
+}
+
+// UpdateLink 修改短網址的目標網址或啟用狀態（僅限擁有者）
+func (h *Handler) UpdateLink(c *fiber.Ctx) error {
+	shortCode := c.Params("short_code")
+	if shortCode == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	var req models.UpdateLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.OriginalURL == nil && req.Enabled == nil && req.OGTitle == nil && req.OGDescription == nil &&
+		req.OGImage == nil && req.TwitterCard == nil && req.Rules == nil && req.Variants == nil &&
+		req.Password == nil && req.RedirectStatus == nil && req.QueryPassthrough == nil &&
+		req.PathForwarding == nil && req.ActiveFrom == nil && req.PrelaunchURL == nil &&
+		req.Tags == nil && req.Campaign == nil && req.ExpiresAt == nil && req.MaxClicks == nil &&
+		!req.ClearActiveFrom && !req.ClearExpiresAt && !req.ClearMaxClicks {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Nothing to update",
+		})
+	}
+
+	update := db.URLUpdate{Enabled: req.Enabled, PathForwarding: req.PathForwarding}
+
+	// 自訂預覽信息，只驗證有提供的欄位
+	overrides := models.PreviewOverrides{
+		OGTitle:       derefString(req.OGTitle),
+		OGDescription: derefString(req.OGDescription),
+		OGImage:       derefString(req.OGImage),
+		TwitterCard:   derefString(req.TwitterCard),
+	}
+	if err := normalizePreviewOverrides(&overrides); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if req.OGTitle != nil {
+		update.OGTitle = &overrides.OGTitle
+	}
+	if req.OGDescription != nil {
+		update.OGDescription = &overrides.OGDescription
+	}
+	if req.OGImage != nil {
+		update.OGImage = &overrides.OGImage
+	}
+	if req.TwitterCard != nil {
+		update.TwitterCard = &overrides.TwitterCard
+	}
+
+	// 重定向規則整組取代
+	if req.Rules != nil {
+		if err := normalizeRedirectRules(*req.Rules); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		update.Rules = req.Rules
+	}
+
+	// A/B 測試目標整組取代
+	if req.Variants != nil {
+		if err := normalizeVariants(*req.Variants); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		update.Variants = req.Variants
+	}
+
+	// 標籤整組取代
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		update.Tags = &tags
+	}
+	if req.Campaign != nil {
+		campaign, err := normalizeCampaign(*req.Campaign)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		update.Campaign = &campaign
+	}
+
+	// 存取密碼，空字串表示移除
+	if req.Password != nil {
+		passwordHash := ""
+		if *req.Password != "" {
+			hash, err := hashPassword(*req.Password)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			passwordHash = hash
+		}
+		update.PasswordHash = &passwordHash
+	}
+
+	// 開放時間、過期時間及點擊次數上限，clear_* 表示清除；開放時間需早於過期時間，查詢短網址後再驗證
+	if (req.ActiveFrom != nil && req.ClearActiveFrom) || (req.ExpiresAt != nil && req.ClearExpiresAt) ||
+		(req.MaxClicks != nil && req.ClearMaxClicks) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "a field and its clear_* flag cannot be used together",
+		})
+	}
+	if req.ActiveFrom != nil || req.ClearActiveFrom {
+		update.ActiveFrom = utcTime(req.ActiveFrom)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "expires_at must be in the future",
+		})
+	}
+	if req.ExpiresAt != nil || req.ClearExpiresAt {
+		update.ExpiresAt = utcTime(req.ExpiresAt)
+	}
+	if req.MaxClicks != nil && *req.MaxClicks < 1 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "max_clicks must be at least 1",
+		})
+	}
+	if req.MaxClicks != nil || req.ClearMaxClicks {
+		update.MaxClicks = &req.MaxClicks
+	}
+	update.PrelaunchURL = req.PrelaunchURL
+
+	// 重定向狀態碼及查詢參數傳遞方式，只驗證有提供的欄位
+	if req.RedirectStatus != nil || req.QueryPassthrough != nil {
+		status := defaultRedirectStatus
+		if req.RedirectStatus != nil {
+			status = *req.RedirectStatus
+		}
+		passthrough := strings.TrimSpace(derefString(req.QueryPassthrough))
+		if err := normalizeRedirectOptions(&status, passthrough); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if req.RedirectStatus != nil {
+			update.RedirectStatus = &status
+		}
+		if req.QueryPassthrough != nil {
+			update.QueryPassthrough = &passthrough
+		}
+	}
+	if req.OriginalURL != nil {
+		// 與建立短網址時相同的標準化及驗證
+		normalizedURL := normalizeURL(*req.OriginalURL)
+		if !isValidURL(normalizedURL) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid URL format",
+			})
+		}
+		update.OriginalURL = &normalizedURL
+	}
+
+	ctx := c.UserContext()
+
+	// 已刪除的短網址需先還原才能修改
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+	if link.DeletedAt != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Short URL not found",
+		})
+	}
+	if !ownsLink(c, link) {
+		return respondForbidden(c)
+	}
+
+	// 開放時間需早於過期時間（未修改的欄位使用目前的值）
+	activeFrom, expiresAt := link.ActiveFrom, link.ExpiresAt
+	if update.ActiveFrom != nil {
+		activeFrom = *update.ActiveFrom
+	}
+	if update.ExpiresAt != nil {
+		expiresAt = *update.ExpiresAt
+	}
+	if err := validateSchedule(activeFrom, expiresAt, update.PrelaunchURL); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	updated, err := h.store.UpdateURL(ctx, shortCode, update)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+
+	log.Printf("Link updated - ShortCode: %s, OriginalURL: %s, Enabled: %v", shortCode, updated.OriginalURL, updated.Enabled)
+	return c.JSON(updated)
+}
+
+// utcTime 轉換為 UTC 並返回可清除欄位的修改值，nil 表示清除
+func utcTime(t *time.Time) **time.Time {
+	if t == nil {
+		return new(*time.Time)
+	}
+	utc := t.UTC()
+	p := &utc
+	return &p
+}
+
+// DeleteLink 軟刪除短網址，之後可透過 RestoreLink 還原
+func (h *Handler) DeleteLink(c *fiber.Ctx) error {
+	return h.setLinkDeleted(c, true)
+}
+
+// RestoreLink 還原已軟刪除的短網址
+func (h *Handler) RestoreLink(c *fiber.Ctx) error {
+	return h.setLinkDeleted(c, false)
+}
+
+// setLinkDeleted 設定短網址的刪除狀態
+func (h *Handler) setLinkDeleted(c *fiber.Ctx, deleted bool) error {
+	shortCode := c.Params("short_code")
+	if shortCode == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	ctx := c.UserContext()
+
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+	if !ownsLink(c, link) {
+		return respondForbidden(c)
+	}
+
+	link, err = h.store.SetURLDeleted(ctx, shortCode, deleted)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+
+	log.Printf("Link deleted state changed - ShortCode: %s, Deleted: %v", shortCode, deleted)
+	return c.JSON(link)
+}
+
+// GetLinkHistory 取得短網址的目標網址修改紀錄
+func (h *Handler) GetLinkHistory(c *fiber.Ctx) error {
+	shortCode := c.Params("short_code")
+	if shortCode == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	ctx := c.UserContext()
+
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+	if !canViewStats(c, link) {
+		return respondForbidden(c)
+	}
+
+	history, err := h.store.ListURLHistory(ctx, link.ID)
+	if err != nil {
+		log.Printf("Error querying link history: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	return c.JSON(models.LinkHistoryResponse{
+		ShortCode:   shortCode,
+		OriginalURL: link.OriginalURL,
+		History:     history,
+	})
+}
+
+// RefreshLinkPreview 重新抓取目標網頁的 Open Graph 信息並更新快取（僅限擁有者）
+func (h *Handler) RefreshLinkPreview(c *fiber.Ctx) error {
+	shortCode := c.Params("short_code")
+	if shortCode == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	ctx := c.UserContext()
+
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+	if link.DeletedAt != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Short URL not found",
+		})
+	}
+	if !ownsLink(c, link) {
+		return respondForbidden(c)
+	}
+
+	preview, err := h.previews.Refresh(ctx, link)
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{
+			"error": "Failed to fetch preview from destination",
+		})
+	}
+
+	log.Printf("Link preview refreshed - ShortCode: %s, Title: %s", shortCode, preview.Title)
+	return c.JSON(preview)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed templates/unlock.html
+var unlockPageTemplate string
+
+var unlockPage = template.Must(template.New("unlock").Parse(unlockPageTemplate))
+
+const (
+	minPasswordLength = 4
+	// maxPasswordLength bcrypt 只使用前 72 個位元組
+	maxPasswordLength = 72
+
+	// unlockCookiePrefix 解鎖 Cookie 名稱前綴，後接短碼
+	unlockCookiePrefix = "unlock_"
+
+	defaultUnlockTTL         = time.Hour
+	defaultUnlockMaxAttempts = 5
+	// defaultUnlockLinkMaxAttempts 同一短網址所有 IP 合計，避免更換 IP 繼續嘗試
+	defaultUnlockLinkMaxAttempts = 50
+	defaultUnlockLockout         = 15 * time.Minute
+)
+
+// hashPassword 驗證並以 bcrypt 雜湊存取密碼，返回給使用者的錯誤訊息
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", fmt.Errorf("password must be between %d and %d bytes", minPasswordLength, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// unlockGuard 受密碼保護短網址的解鎖狀態：簽名的短期 Cookie 及密碼錯誤次數限制
+// 嘗試次數保存在 Store，多個實例及 Vercel 每次請求建立的處理器共用同一份鎖定狀態
+type unlockGuard struct {
+	key             []byte
+	ttl             time.Duration
+	maxAttempts     int // 同一 IP 對同一短網址
+	linkMaxAttempts int // 同一短網址所有 IP 合計
+	lockout         time.Duration
+}
+
+// unlockGuardFromEnv 依 UNLOCK_SECRET、UNLOCK_TTL、UNLOCK_MAX_ATTEMPTS、UNLOCK_LINK_MAX_ATTEMPTS、UNLOCK_LOCKOUT 建立解鎖設定
+func unlockGuardFromEnv() *unlockGuard {
+	g := &unlockGuard{
+		key:             secretFromEnv("UNLOCK_SECRET"),
+		ttl:             defaultUnlockTTL,
+		maxAttempts:     defaultUnlockMaxAttempts,
+		linkMaxAttempts: defaultUnlockLinkMaxAttempts,
+		lockout:         defaultUnlockLockout,
+	}
+	if d, err := time.ParseDuration(os.Getenv("UNLOCK_TTL")); err == nil && d > 0 {
+		g.ttl = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("UNLOCK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		g.maxAttempts = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("UNLOCK_LINK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		g.linkMaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("UNLOCK_LOCKOUT")); err == nil && d > 0 {
+		g.lockout = d
+	}
+	return g
+}
+
+// sign 計算解鎖 Cookie 的簽名，包含密碼雜湊值，修改密碼後舊的 Cookie 自動失效
+func (g *unlockGuard) sign(link *models.URL, expires int64) string {
+	mac := hmac.New(sha256.New, g.key)
+	fmt.Fprintf(mac, "%s|%d|%s", link.ShortCode, expires, link.PasswordHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// unlocked 檢查請求是否帶有該短網址有效的解鎖 Cookie
+func (g *unlockGuard) unlocked(c *fiber.Ctx, link *models.URL) bool {
+	expiresText, signature, ok := strings.Cut(c.Cookies(unlockCookiePrefix+link.ShortCode), ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresText, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(g.sign(link, expires)))
+}
+
+// setCookie 設定解鎖 Cookie
+func (g *unlockGuard) setCookie(c *fiber.Ctx, link *models.URL) {
+	expires := time.Now().Add(g.ttl)
+	c.Cookie(&fiber.Cookie{
+		Name:     unlockCookiePrefix + link.ShortCode,
+		Value:    fmt.Sprintf("%d.%s", expires.Unix(), g.sign(link, expires.Unix())),
+		Path:     "/",
+		Expires:  expires,
+		Secure:   c.Protocol() == "https" || c.Get("X-Forwarded-Proto") == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// reserveAttempt 驗證密碼前先累計一次嘗試（同一 IP 及整個短網址），超過限制時返回 false
+// 先累計再檢查，同時送出的請求也不會超過限制；密碼正確時由 releaseAttempt 退回
+func (h *Handler) reserveAttempt(ctx context.Context, link *models.URL, ip string) (bool, error) {
+	since := time.Now().Add(-h.unlock.lockout)
+	attempts, err := h.store.AddUnlockAttempts(ctx, unlockAttemptKey(link, ip), 1, since)
+	if err != nil || attempts > h.unlock.maxAttempts {
+		return false, err
+	}
+	attempts, err = h.store.AddUnlockAttempts(ctx, unlockAttemptKey(link, ""), 1, since)
+	if err != nil || attempts > h.unlock.linkMaxAttempts {
+		// 被整個短網址的限制拒絕時退回該 IP 的嘗試，不佔用其次數
+		if _, undoErr := h.store.AddUnlockAttempts(ctx, unlockAttemptKey(link, ip), -1, since); undoErr != nil && err == nil {
+			err = undoErr
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseAttempt 密碼正確後清除該 IP 的錯誤次數，並退回整個短網址的一次嘗試
+func (h *Handler) releaseAttempt(ctx context.Context, link *models.URL, ip string) error {
+	since := time.Now().Add(-h.unlock.lockout)
+	if err := h.store.ResetUnlockAttempts(ctx, unlockAttemptKey(link, ip), since); err != nil {
+		return err
+	}
+	_, err := h.store.AddUnlockAttempts(ctx, unlockAttemptKey(link, ""), -1, since)
+	return err
+}
+
+// unlockAttemptKey 嘗試次數的鍵，ip 為空字串時表示整個短網址
+func unlockAttemptKey(link *models.URL, ip string) string {
+	if ip == "" {
+		return link.ID.String()
+	}
+	return link.ID.String() + "|" + ip
+}
+
+// sendUnlockPage 返回輸入密碼的頁面
+func sendUnlockPage(c *fiber.Ctx, status int, message string) error {
+	var page strings.Builder
+	data := struct {
+		Action string
+		Error  string
+	}{
+		Action: c.OriginalURL(),
+		Error:  message,
+	}
+	if err := unlockPage.Execute(&page, data); err != nil {
+		log.Printf("Error rendering unlock page: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to render unlock page",
+		})
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	c.Set("Cache-Control", "no-store")
+	c.Set("X-Robots-Tag", "noindex")
+	return c.Status(status).SendString(page.String())
+}
+
+// UnlockURL 驗證受密碼保護短網址的密碼，成功後設定解鎖 Cookie 並回到重定向網址
+func (h *Handler) UnlockURL(c *fiber.Ctx) error {
+	shortCode := c.Params("short_code")
+	if shortCode == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	ctx := c.UserContext()
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return respondLookupError(c, err)
+	}
+	if link.DeletedAt != nil || (c.Params("*") != "" && !link.PathForwarding) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Short URL not found",
+		})
+	}
+
+	// 不需要密碼或已解鎖時直接回到重定向網址，由 RedirectURL 處理停用、過期等狀態
+	if link.PasswordHash == "" || h.unlock.unlocked(c, link) {
+		return c.Redirect(c.OriginalURL(), 303)
+	}
+
+	// ProxyHeader 已設定時 c.IP() 取自 X-Forwarded-For 中第一個有效的 IP，客戶端可自行填寫，
+	// 需由會覆寫此標頭的代理伺服器轉發，或設定 TRUSTED_PROXIES 只接受代理伺服器的標頭
+	ip := c.IP()
+	allowed, err := h.reserveAttempt(ctx, link, ip)
+	if err != nil {
+		log.Printf("Error recording unlock attempt for short_code %s: %v", shortCode, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to verify password",
+		})
+	}
+	if !allowed {
+		log.Printf("Unlock attempts exceeded - ShortCode: %s, IP: %s", shortCode, ip)
+		return sendUnlockPage(c, 429, "密碼錯誤次數過多，請稍後再試")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(c.FormValue("password")))
+	if err != nil {
+		if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			log.Printf("Error verifying password for short_code %s: %v", shortCode, err)
+		}
+		if err := h.store.RecordFailedUnlock(ctx, link.ID); err != nil {
+			log.Printf("Error recording failed unlock for short_code %s: %v", shortCode, err)
+		}
+		return sendUnlockPage(c, 401, "密碼錯誤")
+	}
+
+	if err := h.releaseAttempt(ctx, link, ip); err != nil {
+		log.Printf("Error resetting unlock attempts for short_code %s: %v", shortCode, err)
+	}
+	h.unlock.setCookie(c, link)
+	return c.Redirect(c.OriginalURL(), 303)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"go-shorturl/pkg/models"
+	"go-shorturl/pkg/safehttp"
+)
+
+//go:embed templates/preview.html
+var defaultPreviewTemplate string
+
+const (
+	// defaultTwitterCard 未自訂時使用的 twitter:card 類型
+	defaultTwitterCard = "summary_large_image"
+
+	maxOGTitleLength       = 200
+	maxOGDescriptionLength = 1000
+)
+
+// twitterCardTypes 允許的 twitter:card 類型
+var twitterCardTypes = map[string]bool{
+	"summary":             true,
+	"summary_large_image": true,
+	"app":                 true,
+	"player":              true,
+}
+
+// PreviewData 社交媒體爬蟲預覽頁面的模板資料，所有欄位都會依所在位置自動轉義
+type PreviewData struct {
+	ShortCode   string
+	ShortURL    string
+	OriginalURL string
+	Title       string
+	Description string
+	Image       string
+	Type        string
+	SiteName    string
+	TwitterCard string
+}
+
+// ParsePreviewTemplate 解析預覽頁面模板
+func ParsePreviewTemplate(text string) (*template.Template, error) {
+	return template.New("preview").Parse(text)
+}
+
+// LoadPreviewTemplate 從檔案載入預覽頁面模板，path 為空時使用內建模板
+func LoadPreviewTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return ParsePreviewTemplate(defaultPreviewTemplate)
+	}
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preview template %s: %w", path, err)
+	}
+	tmpl, err := ParsePreviewTemplate(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse preview template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// previewTemplateFromEnv 載入 PREVIEW_TEMPLATE_PATH 指定的模板，失敗時使用內建模板
+func previewTemplateFromEnv() *template.Template {
+	tmpl, err := LoadPreviewTemplate(os.Getenv("PREVIEW_TEMPLATE_PATH"))
+	if err != nil {
+		log.Printf("Error loading preview template, using default: %v", err)
+		tmpl = template.Must(ParsePreviewTemplate(defaultPreviewTemplate))
+	}
+	return tmpl
+}
+
+// normalizePreviewOverrides 去除自訂預覽信息的前後空白並驗證，返回給使用者的錯誤訊息
+func normalizePreviewOverrides(overrides *models.PreviewOverrides) error {
+	overrides.OGTitle = strings.TrimSpace(overrides.OGTitle)
+	overrides.OGDescription = strings.TrimSpace(overrides.OGDescription)
+	overrides.OGImage = strings.TrimSpace(overrides.OGImage)
+	overrides.TwitterCard = strings.TrimSpace(overrides.TwitterCard)
+
+	if utf8.RuneCountInString(overrides.OGTitle) > maxOGTitleLength {
+		return fmt.Errorf("og_title must be at most %d characters", maxOGTitleLength)
+	}
+	if utf8.RuneCountInString(overrides.OGDescription) > maxOGDescriptionLength {
+		return fmt.Errorf("og_description must be at most %d characters", maxOGDescriptionLength)
+	}
+	if overrides.OGImage != "" {
+		imageURL, err := url.Parse(overrides.OGImage)
+		if err != nil || safehttp.CheckURL(imageURL) != nil {
+			return fmt.Errorf("og_image must be an absolute http or https URL")
+		}
+	}
+	if overrides.TwitterCard != "" && !twitterCardTypes[overrides.TwitterCard] {
+		return fmt.Errorf("twitter_card must be one of summary, summary_large_image, app, player")
+	}
+	return nil
+}
+
+// generateMetaHTML 生成包含Open Graph meta標籤的HTML頁面，自訂的預覽信息優先於抓取的內容
+func (h *Handler) generateMetaHTML(ctx context.Context, link *models.URL, baseURL string) (string, error) {
+	// 目標網頁的Open Graph信息（優先使用快取），全部自訂時不需要抓取
+	ogMeta := models.LinkPreview{Type: "website"}
+	if link.OGTitle == "" || link.OGDescription == "" || link.OGImage == "" {
+		ogMeta = h.previews.Get(ctx, link)
+	}
+
+	data := PreviewData{
+		ShortCode:   link.ShortCode,
+		ShortURL:    fmt.Sprintf("%s/url/%s", baseURL, link.ShortCode), // 構建完整的短網址URL
+		OriginalURL: link.OriginalURL,
+		Title:       firstNonEmpty(link.OGTitle, ogMeta.Title),
+		Description: firstNonEmpty(link.OGDescription, ogMeta.Description),
+		Image:       firstNonEmpty(link.OGImage, resolveImageURL(ogMeta.Image, link.OriginalURL)),
+		Type:        ogMeta.Type,
+		SiteName:    ogMeta.SiteName,
+		TwitterCard: firstNonEmpty(link.TwitterCard, defaultTwitterCard),
+	}
+
+	// 如果沒有圖片，使用默認圖片
+	if data.Image == "" {
+		data.Image = fmt.Sprintf("%s/og-image.png", baseURL)
+	}
+
+	var html strings.Builder
+	if err := h.preview.Execute(&html, data); err != nil {
+		return "", err
+	}
+	return html.String(), nil
+}
+
+// resolveImageURL 確保圖片URL是絕對路徑
+func resolveImageURL(imageURL, pageURL string) string {
+	if imageURL == "" || strings.HasPrefix(imageURL, "http://") || strings.HasPrefix(imageURL, "https://") {
+		return imageURL
+	}
+
+	parsedURL, err := url.Parse(pageURL)
+	if err != nil {
+		return imageURL
+	}
+	if absImageURL, err := parsedURL.Parse(imageURL); err == nil {
+		return absImageURL.String()
+	}
+
+	// 如果解析失敗，嘗試拼接
+	if parsedURL.Scheme != "" && parsedURL.Host != "" {
+		baseURL := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
+		if strings.HasPrefix(imageURL, "/") {
+			return baseURL + imageURL
+		}
+		return baseURL + "/" + imageURL
+	}
+	return imageURL
+}
+
+// firstNonEmpty 返回第一個非空字串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPreviewCacheTTL  = 24 * time.Hour
+	defaultPreviewCacheSize = 1000
+	// previewFailureTTL 抓取失敗後多久再重試，避免每次爬蟲訪問都重新抓取
+	previewFailureTTL = 5 * time.Minute
+	// previewRefreshTimeout 背景重新抓取及儲存的超時
+	previewRefreshTimeout = 10 * time.Second
+)
+
+// previewEntry 記憶體快取中的一筆預覽信息
+type previewEntry struct {
+	preview models.LinkPreview
+	staleAt time.Time // 超過此時間後在背景重新抓取
+}
+
+// previewCache Open Graph 信息快取：記憶體 LRU 在前、資料庫在後，
+// 過期後仍先返回舊資料，並在背景重新抓取
+type previewCache struct {
+	store    db.Store
+	fetch    func(targetURL string) (OGMetadata, error)
+	ttl      time.Duration
+	capacity int
+
+	mu         sync.Mutex
+	entries    map[uuid.UUID]*list.Element
+	order      *list.List // 最近使用的在前
+	refreshing map[uuid.UUID]bool
+}
+
+// newPreviewCache 建立預覽快取
+func newPreviewCache(store db.Store, fetch func(string) (OGMetadata, error), ttl time.Duration, capacity int) *previewCache {
+	return &previewCache{
+		store:      store,
+		fetch:      fetch,
+		ttl:        ttl,
+		capacity:   capacity,
+		entries:    make(map[uuid.UUID]*list.Element),
+		order:      list.New(),
+		refreshing: make(map[uuid.UUID]bool),
+	}
+}
+
+// previewCacheFromEnv 依 PREVIEW_CACHE_TTL、PREVIEW_CACHE_SIZE 建立預覽快取
+func previewCacheFromEnv(store db.Store) *previewCache {
+	ttl := defaultPreviewCacheTTL
+	if d, err := time.ParseDuration(os.Getenv("PREVIEW_CACHE_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+	capacity := defaultPreviewCacheSize
+	if n, err := strconv.Atoi(os.Getenv("PREVIEW_CACHE_SIZE")); err == nil && n > 0 {
+		capacity = n
+	}
+	return newPreviewCache(store, fetchOGMetadata, ttl, capacity)
+}
+
+// Get 取得短網址的預覽信息，快取中沒有時同步抓取
+func (c *previewCache) Get(ctx context.Context, link *models.URL) models.LinkPreview {
+	now := time.Now()
+
+	if entry, ok := c.lookup(link.ID); ok && entry.preview.SourceURL == link.OriginalURL {
+		if now.After(entry.staleAt) {
+			c.refreshAsync(link)
+		}
+		return entry.preview
+	}
+
+	preview, err := c.store.GetLinkPreview(ctx, link.ID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		log.Printf("Error querying link preview: %v", err)
+	}
+	// 目標網址變更後舊的預覽信息不再使用
+	if err == nil && preview.SourceURL == link.OriginalURL {
+		staleAt := preview.FetchedAt.Add(c.ttl)
+		c.add(*preview, staleAt)
+		if now.After(staleAt) {
+			c.refreshAsync(link)
+		}
+		return *preview
+	}
+
+	refreshed, _ := c.Refresh(ctx, link)
+	return refreshed
+}
+
+// Refresh 重新抓取並儲存預覽信息；抓取失敗時保留原有的快取並返回錯誤
+func (c *previewCache) Refresh(ctx context.Context, link *models.URL) (models.LinkPreview, error) {
+	now := time.Now()
+	metadata, err := c.fetch(link.OriginalURL)
+	if err != nil {
+		log.Printf("Error fetching OG metadata for %s: %v", link.ShortCode, err)
+
+		// 已有同一目標網址的快取時繼續使用，否則暫時使用預設值，稍後再重試
+		if entry, ok := c.lookup(link.ID); ok && entry.preview.SourceURL == link.OriginalURL {
+			c.add(entry.preview, now.Add(previewFailureTTL))
+			return entry.preview, err
+		}
+		preview := newLinkPreview(link, metadata, now)
+		c.add(preview, now.Add(previewFailureTTL))
+		return preview, err
+	}
+
+	preview := newLinkPreview(link, metadata, now)
+	c.add(preview, now.Add(c.ttl))
+	if err := c.store.SaveLinkPreview(ctx, &preview); err != nil {
+		log.Printf("Error saving link preview: %v", err)
+	}
+	return preview, nil
+}
+
+// refreshAsync 在背景重新抓取，同一短網址同時只會有一個抓取
+func (c *previewCache) refreshAsync(link *models.URL) {
+	c.mu.Lock()
+	if c.refreshing[link.ID] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[link.ID] = true
+	c.mu.Unlock()
+
+	target := *link
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, target.ID)
+			c.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), previewRefreshTimeout)
+		defer cancel()
+		c.Refresh(ctx, &target)
+	}()
+}
+
+// lookup 從記憶體快取取得預覽信息並標記為最近使用
+func (c *previewCache) lookup(urlID uuid.UUID) (previewEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[urlID]
+	if !ok {
+		return previewEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *elem.Value.(*previewEntry), true
+}
+
+// add 加入或更新記憶體快取，超過容量時移除最久未使用的項目
+func (c *previewCache) add(preview models.LinkPreview, staleAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[preview.URLID]; ok {
+		elem.Value = &previewEntry{preview: preview, staleAt: staleAt}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[preview.URLID] = c.order.PushFront(&previewEntry{preview: preview, staleAt: staleAt})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*previewEntry).preview.URLID)
+	}
+}
+
+// newLinkPreview 以抓取到的 Open Graph 信息建立預覽記錄
+func newLinkPreview(link *models.URL, metadata OGMetadata, fetchedAt time.Time) models.LinkPreview {
+	return models.LinkPreview{
+		URLID:       link.ID,
+		SourceURL:   link.OriginalURL,
+		Title:       metadata.Title,
+		Description: metadata.Description,
+		Image:       metadata.Image,
+		Type:        metadata.Type,
+		SiteName:    metadata.SiteName,
+		FetchedAt:   fetchedAt,
+	}
+}
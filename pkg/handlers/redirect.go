@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultRedirectStatus = 302
+
+	// 查詢參數傳遞方式：preserve 目標網址已有的參數優先，override 訪客帶入的參數優先
+	queryPassthroughPreserve = "preserve"
+	queryPassthroughOverride = "override"
+)
+
+// redirectStatuses 允許的重定向狀態碼
+var redirectStatuses = map[int]bool{
+	301: true,
+	302: true,
+	307: true,
+	308: true,
+}
+
+// normalizeRedirectOptions 驗證重定向狀態碼及查詢參數傳遞方式，狀態碼為 0 時使用預設值，返回給使用者的錯誤訊息
+func normalizeRedirectOptions(status *int, passthrough string) error {
+	if *status == 0 {
+		*status = defaultRedirectStatus
+	}
+	if !redirectStatuses[*status] {
+		return fmt.Errorf("redirect_status must be one of 301, 302, 307, 308")
+	}
+	if passthrough != "" && passthrough != queryPassthroughPreserve && passthrough != queryPassthroughOverride {
+		return fmt.Errorf("query_passthrough must be one of preserve, override")
+	}
+	return nil
+}
+
+// redirectStatus 短網址的重定向狀態碼
+func redirectStatus(link *models.URL) int {
+	if redirectStatuses[link.RedirectStatus] {
+		return link.RedirectStatus
+	}
+	return defaultRedirectStatus
+}
+
+// cacheableRedirect 檢查重定向結果能否被瀏覽器快取
+// 受密碼保護、會過期或有點擊上限的短網址每次都需要經過伺服器檢查；
+// 有重定向規則、A/B 測試、查詢參數傳遞或路徑轉發的短網址目標網址因請求而異
+func cacheableRedirect(link *models.URL) bool {
+	if link.PasswordHash != "" || link.ExpiresAt != nil || link.MaxClicks != nil {
+		return false
+	}
+	if len(link.Rules) > 0 || len(link.Variants) > 0 || link.QueryPassthrough != "" || link.PathForwarding {
+		return false
+	}
+	return true
+}
+
+// sendRedirect 以短網址設定的狀態碼重定向
+func sendRedirect(c *fiber.Ctx, link *models.URL, destination string) error {
+	if !cacheableRedirect(link) {
+		c.Set("Cache-Control", "private, no-store")
+	}
+	return c.Redirect(destination, redirectStatus(link))
+}
+
+// appendPath 將短碼之後的路徑（保持原始編碼）附加到目標網址的路徑之後，保留目標網址的查詢參數
+// 路徑包含 . 或 .. 片段（包括編碼後的 %2e）時返回 false，避免跳出目標網址的路徑前綴
+func appendPath(destination, rest string) (string, bool) {
+	if rest == "" {
+		return destination, true
+	}
+	for _, segment := range strings.Split(rest, "/") {
+		segment = strings.ReplaceAll(strings.ToLower(segment), "%2e", ".")
+		if segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", false
+	}
+	escaped := strings.TrimSuffix(target.EscapedPath(), "/") + "/" + rest
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", false
+	}
+	target.Path = path
+	target.RawPath = escaped
+	return target.String(), true
+}
+
+// mergeQuery 將訪客帶入的查詢參數合併到目標網址，保留目標網址原有參數的順序及編碼
+// preserve 時只加入目標網址沒有的參數，override 時同名參數以訪客帶入的值取代
+func mergeQuery(destination, rawQuery, mode string) string {
+	if mode == "" || rawQuery == "" {
+		return destination
+	}
+
+	target, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	existing := queryKeys(target.RawQuery)
+	incoming := queryKeys(rawQuery)
+
+	var pairs []string
+	for _, pair := range splitQuery(target.RawQuery) {
+		if mode == queryPassthroughOverride && incoming[queryKey(pair)] {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	for _, pair := range splitQuery(rawQuery) {
+		if mode == queryPassthroughPreserve && existing[queryKey(pair)] {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+
+	target.RawQuery = strings.Join(pairs, "&")
+	return target.String()
+}
+
+// splitQuery 將查詢字串拆成 key=value 片段，忽略空片段
+func splitQuery(rawQuery string) []string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// queryKey 取得 key=value 片段解碼後的參數名稱
+func queryKey(pair string) string {
+	key, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+// queryKeys 查詢字串中出現的參數名稱
+func queryKeys(rawQuery string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, pair := range splitQuery(rawQuery) {
+		keys[queryKey(pair)] = true
+	}
+	return keys
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/hll"
+	"go-shorturl/pkg/rollup"
+
+	"github.com/google/uuid"
+)
+
+// ClassifyClickGroup 補全點擊分組的統計維度：未記錄的設備類型及操作系統從 User-Agent 解析，
+// 沒有來源或來自本站的點擊歸類為「直接訪問」
+func ClassifyClickGroup(group *db.ClickGroup) {
+	if group.DeviceType == "" {
+		group.DeviceType = parseDeviceType(group.UserAgent)
+	}
+	if group.OS == "" {
+		group.OS = parseOS(group.UserAgent)
+	}
+	if group.ReferrerDomain == "" || strings.Contains(group.ReferrerDomain, "xsong.us") {
+		group.ReferrerDomain = "直接訪問"
+	}
+	group.UserAgent = ""
+}
+
+// clickBreakdown 短網址點擊的各維度計數
+type clickBreakdown struct {
+	includeBots bool // 爬蟲的點擊是否計入各維度
+
+	total       int
+	bots        map[string]int // 爬蟲的點擊數（不論是否計入各維度）
+	deviceTypes map[string]int
+	oses        map[string]int
+	countries   map[string]int
+	referrers   map[string]int
+	targets     map[string]int
+	variants    map[string]int // 分配到 A/B 測試目標的點擊（不含未參與分流的點擊）
+	visitors    *hll.Sketch    // 所有訪客
+
+	variantVisitors map[string]*hll.Sketch // 各 A/B 測試目標的訪客
+
+	// 時間分布使用，只有統計範圍對齊 UTC 整點時才會取得
+	hourly          []db.ClickRollup   // 每小時點擊數
+	visitorSketches []db.VisitorSketch // 每小時（UTC 範圍以日為時間段時為每日）訪客 sketch
+}
+
+// add 累加一筆彙總記錄，爬蟲的點擊只在 includeBots 時計入各維度，返回是否計入
+func (b *clickBreakdown) add(r db.ClickRollup) bool {
+	if r.IsBot {
+		name := r.BotName
+		if name == "" {
+			name = "Other"
+		}
+		b.bots[name] += r.Clicks
+		if !b.includeBots {
+			return false
+		}
+	}
+	b.total += r.Clicks
+	b.deviceTypes[r.DeviceType] += r.Clicks
+	b.oses[r.OS] += r.Clicks
+	b.countries[r.Country] += r.Clicks
+	b.referrers[r.ReferrerDomain] += r.Clicks
+	b.targets[r.Target] += r.Clicks
+	if r.Variant != "" {
+		b.variants[r.Variant] += r.Clicks
+	}
+	return true
+}
+
+// loadClickBreakdown 統計範圍內的點擊：整點時間段讀取彙總表，加上寫入時間在彙總進度之後（尚未彙總）的原始點擊；
+// 前後不足一小時的部分查詢原始點擊。沒有執行彙總（例如只部署在 Vercel）時進度不會推進，統計都來自原始點擊
+func (h *Handler) loadClickBreakdown(ctx context.Context, urlID uuid.UUID, r statsRange, includeBots bool) (*clickBreakdown, error) {
+	b := &clickBreakdown{
+		includeBots: includeBots,
+		bots:        make(map[string]int),
+		deviceTypes: make(map[string]int),
+		oses:        make(map[string]int),
+		countries:   make(map[string]int),
+		referrers:   make(map[string]int),
+		targets:     make(map[string]int),
+		variants:    make(map[string]int),
+		visitors:    hll.New(),
+
+		variantVisitors: make(map[string]*hll.Sketch),
+	}
+
+	watermark, err := h.store.ClickRollupWatermark(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 彙總表涵蓋的時間段：from 之後的第一個整點到 to 之前的最後一個整點
+	start := r.From.UTC().Truncate(time.Hour)
+	if start.Before(r.From) {
+		start = start.Add(time.Hour)
+	}
+	end := r.To.UTC().Truncate(time.Hour)
+
+	raw := []db.ClickScope{{URLID: &urlID, From: r.From, To: r.To}}
+	if start.Before(end) {
+		raw = []db.ClickScope{
+			{URLID: &urlID, From: r.From, To: start},
+			{URLID: &urlID, From: start, To: end, InsertedFrom: watermark},
+			{URLID: &urlID, From: end, To: r.To},
+		}
+
+		rollups, err := h.store.ListClickRollups(ctx, urlID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, rollup := range rollups {
+			b.add(rollup)
+		}
+
+		if r.hourAligned() {
+			b.hourly, err = h.store.HourlyClicks(ctx, urlID, start, end, includeBots)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// 時間分布需要每小時的 sketch，否則使用每日 sketch 減少讀取量
+		var sketches []db.VisitorSketch
+		if r.hourAligned() && !r.dayAligned() {
+			sketches, err = h.store.HourlyVisitors(ctx, urlID, start, end)
+		} else {
+			sketches, err = h.store.ListVisitorSketches(ctx, urlID, start, end)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b.visitorSketches = append(b.visitorSketches, sketches...)
+	}
+
+	for _, scope := range raw {
+		if !scope.From.Before(scope.To) {
+			continue
+		}
+		groups, err := h.store.ClickGroups(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range rollup.Merge(groups, ClassifyClickGroup) {
+			if b.add(group) {
+				b.hourly = append(b.hourly, db.ClickRollup{URLID: urlID, Bucket: group.Bucket, Clicks: group.Clicks})
+			}
+		}
+
+		visitors, err := h.store.ClickVisitors(ctx, scope, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		b.visitorSketches = append(b.visitorSketches, rollup.Sketches(visitors)...)
+	}
+
+	for _, v := range b.visitorSketches {
+		b.visitors.Merge(v.Sketch)
+		if v.Variant == "" {
+			continue
+		}
+		if b.variantVisitors[v.Variant] == nil {
+			b.variantVisitors[v.Variant] = hll.New()
+		}
+		b.variantVisitors[v.Variant].Merge(v.Sketch)
+	}
+	return b, nil
+}
+
+// keyCount 計數結果
+type keyCount struct {
+	Key   string
+	Count int
+}
+
+// topCounts 依計數由多到少排序（相同時依名稱），略過 skip 中的鍵，limit 為 0 表示不限制
+func topCounts(counts map[string]int, limit int, skip ...string) []keyCount {
+	result := make([]keyCount, 0, len(counts))
+	for key, count := range counts {
+		if count > 0 && !slices.Contains(skip, key) {
+			result = append(result, keyCount{Key: key, Count: count})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
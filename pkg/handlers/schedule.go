@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+//go:embed templates/prelaunch.html
+var defaultPrelaunchTemplate string
+
+var defaultPrelaunchPage = template.Must(template.New("prelaunch").Parse(defaultPrelaunchTemplate))
+
+// PrelaunchData 開放前倒數頁面的模板資料
+type PrelaunchData struct {
+	ShortCode  string
+	ActiveFrom string // RFC 3339 格式的開放時間
+}
+
+// isLinkScheduled 檢查短網址是否尚未到開放時間
+func isLinkScheduled(link *models.URL, now time.Time) bool {
+	return link.ActiveFrom != nil && now.Before(*link.ActiveFrom)
+}
+
+// validateSchedule 驗證開放時間及開放前的目標網址，返回給使用者的錯誤訊息
+func validateSchedule(activeFrom, expiresAt *time.Time, prelaunchURL *string) error {
+	if activeFrom != nil && expiresAt != nil && !activeFrom.Before(*expiresAt) {
+		return fmt.Errorf("active_from must be before expires_at")
+	}
+	if prelaunchURL != nil && *prelaunchURL != "" {
+		*prelaunchURL = normalizeURL(strings.TrimSpace(*prelaunchURL))
+		if !isValidURL(*prelaunchURL) {
+			return fmt.Errorf("invalid prelaunch_url")
+		}
+	}
+	return nil
+}
+
+// sendPrelaunchResponse 開放前的回應：設定了 prelaunch_url 時重定向到該網址，
+// 否則返回 503 及倒數頁面（可透過 PRELAUNCH_PAGE_PATH 指定模板）
+func sendPrelaunchResponse(c *fiber.Ctx, link *models.URL) error {
+	c.Set("Cache-Control", "private, no-store")
+	if link.PrelaunchURL != "" {
+		return c.Redirect(link.PrelaunchURL, 302)
+	}
+
+	page := defaultPrelaunchPage
+	if pagePath := os.Getenv("PRELAUNCH_PAGE_PATH"); pagePath != "" {
+		tmpl, err := template.ParseFiles(pagePath)
+		if err != nil {
+			log.Printf("Error loading prelaunch page %s: %v", pagePath, err)
+		} else {
+			page = tmpl
+		}
+	}
+
+	var html strings.Builder
+	data := PrelaunchData{
+		ShortCode:  link.ShortCode,
+		ActiveFrom: link.ActiveFrom.UTC().Format(time.RFC3339),
+	}
+	if err := page.Execute(&html, data); err != nil {
+		log.Printf("Error rendering prelaunch page: %v", err)
+		return c.Status(503).JSON(fiber.Map{
+			"error":       "Short URL is not active yet",
+			"active_from": link.ActiveFrom,
+		})
+	}
+
+	retryAfter := int(math.Ceil(time.Until(*link.ActiveFrom).Seconds()))
+	c.Set("Retry-After", strconv.Itoa(retryAfter))
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	return c.Status(503).SendString(html.String())
+}
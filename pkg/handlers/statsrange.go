@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/hll"
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// defaultStatsTimezone 未指定 tz 時使用的時區
+	defaultStatsTimezone = "Asia/Shanghai"
+
+	// maxStatsBuckets 時間分布最多的時間段數
+	maxStatsBuckets = 1000
+	// autoStatsBuckets 未指定 granularity 時，選擇時間段數不超過此值的最細粒度
+	autoStatsBuckets = 200
+
+	defaultClickListLimit = 1000
+	maxClickListLimit     = 5000
+)
+
+// 時間分布的時間段
+const (
+	granularityMinute = "minute"
+	granularityHour   = "hour"
+	granularityDay    = "day"
+	granularityWeek   = "week"
+	granularityMonth  = "month"
+)
+
+// timeRange 查詢參數指定的時間範圍 [From, To)，未指定的一端為零值
+type timeRange struct {
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// parseTimeParam 解析時間參數：RFC 3339 或 tz 時區的本地時間（YYYY-MM-DD、YYYY-MM-DDTHH:MM[:SS]）
+// 只有日期的 to 包含當天
+func parseTimeParam(value string, loc *time.Location, end bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, true
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseTimeRange 解析 from、to 及 tz 參數，返回給使用者的錯誤訊息
+func parseTimeRange(c *fiber.Ctx) (timeRange, error) {
+	var r timeRange
+
+	name := c.Query("tz", defaultStatsTimezone)
+	loc, err := time.LoadLocation(name)
+	if err != nil || strings.EqualFold(name, "local") {
+		return r, errors.New("tz must be an IANA time zone name")
+	}
+	r.Location = loc
+
+	if value := c.Query("from"); value != "" {
+		t, ok := parseTimeParam(value, loc, false)
+		if !ok {
+			return r, errors.New("from must be an RFC 3339 time or YYYY-MM-DD")
+		}
+		r.From = t
+	}
+	if value := c.Query("to"); value != "" {
+		t, ok := parseTimeParam(value, loc, true)
+		if !ok {
+			return r, errors.New("to must be an RFC 3339 time or YYYY-MM-DD")
+		}
+		r.To = t
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.To.After(r.From) {
+		return r, errors.New("to must be after from")
+	}
+	return r, nil
+}
+
+// parseIncludeBots 解析 include_bots 參數，預設不包含爬蟲的點擊
+func parseIncludeBots(c *fiber.Ctx) (bool, error) {
+	return parseBoolQuery(c, "include_bots")
+}
+
+// parseBoolQuery 解析布林查詢參數，未提供時為 false
+func parseBoolQuery(c *fiber.Ctx, name string) (bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return false, nil
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New(name + " must be true or false")
+	}
+	return result, nil
+}
+
+// statsRange 已補全並對齊時間段的統計範圍
+type statsRange struct {
+	timeRange
+	Granularity string
+}
+
+// bucketStart 取得 t 所在時間段的起點（依時區的本地時間對齊，週從星期一開始）
+func bucketStart(t time.Time, granularity string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch granularity {
+	case granularityMinute:
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, loc)
+	case granularityHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+	case granularityWeek:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case granularityMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucket 取得下一個時間段的起點
+func nextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case granularityMinute:
+		return start.Add(time.Minute)
+	case granularityHour:
+		return start.Add(time.Hour)
+	case granularityWeek:
+		return start.AddDate(0, 0, 7)
+	case granularityMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// countBuckets 計算 [from, to) 涵蓋的時間段數，超過 limit 時返回 limit+1
+func countBuckets(from, to time.Time, granularity string, loc *time.Location, limit int) int {
+	n := 0
+	for t := bucketStart(from, granularity, loc); t.Before(to) && n <= limit; t = nextBucket(t, granularity) {
+		n++
+	}
+	return n
+}
+
+// resolveStatsRange 解析統計範圍：未指定時從短網址建立時間到 now，起訖時間對齊到時間段
+// 未指定 granularity 時選擇時間段數不超過 autoStatsBuckets 的最細粒度
+func resolveStatsRange(c *fiber.Ctx, link *models.URL, now time.Time) (statsRange, error) {
+	tr, err := parseTimeRange(c)
+	if err != nil {
+		return statsRange{}, err
+	}
+	r := statsRange{timeRange: tr}
+	if r.From.IsZero() {
+		r.From = link.CreatedAt
+	}
+	if r.To.IsZero() {
+		r.To = now
+	}
+	if !r.To.After(r.From) {
+		r.To = r.From.Add(time.Second)
+	}
+
+	r.Granularity = c.Query("granularity")
+	switch r.Granularity {
+	case "":
+		r.Granularity = granularityMonth
+		for _, g := range []string{granularityHour, granularityDay, granularityWeek} {
+			if countBuckets(r.From, r.To, g, r.Location, autoStatsBuckets) <= autoStatsBuckets {
+				r.Granularity = g
+				break
+			}
+		}
+	case granularityMinute, granularityHour, granularityDay, granularityWeek, granularityMonth:
+		if countBuckets(r.From, r.To, r.Granularity, r.Location, maxStatsBuckets) > maxStatsBuckets {
+			return r, fmt.Errorf("range is too long for granularity %s (at most %d buckets)", r.Granularity, maxStatsBuckets)
+		}
+	default:
+		return r, errors.New("granularity must be one of minute, hour, day, week, month")
+	}
+
+	r.From = bucketStart(r.From, r.Granularity, r.Location)
+	if start := bucketStart(r.To, r.Granularity, r.Location); start.Before(r.To) {
+		r.To = nextBucket(start, r.Granularity)
+	}
+	return r, nil
+}
+
+// model 轉換為回應中的統計範圍
+func (r statsRange) model() models.StatsRange {
+	return models.StatsRange{
+		From:        r.From.In(r.Location),
+		To:          r.To.In(r.Location),
+		Timezone:    r.Location.String(),
+		Granularity: r.Granularity,
+	}
+}
+
+// hourAligned 判斷時間段是否都落在 UTC 整點上（可使用每小時彙總），
+// 分鐘粒度或非整點時差的時區需要原始點擊
+func (r statsRange) hourAligned() bool {
+	if r.Granularity == granularityMinute {
+		return false
+	}
+	for _, t := range []time.Time{r.From, r.To} {
+		if _, offset := t.In(r.Location).Zone(); offset%3600 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// dayAligned 判斷時間段是否都由完整的 UTC 日組成（可使用每日彙總）
+func (r statsRange) dayAligned() bool {
+	switch r.Granularity {
+	case granularityDay, granularityWeek, granularityMonth:
+		return r.Location == time.UTC
+	}
+	return false
+}
+
+// timeSeries 將各時間點的點擊數及訪客 sketch 歸入時間段，沒有點擊的時間段補零
+func (r statsRange) timeSeries(counts []db.ClickRollup, visitors []db.VisitorSketch) []models.TimeDistributionStat {
+	layout := "2006-01-02"
+	switch r.Granularity {
+	case granularityMinute:
+		layout = "2006-01-02 15:04"
+	case granularityHour:
+		layout = "2006-01-02 15:00"
+	case granularityMonth:
+		layout = "2006-01"
+	}
+
+	stats := []models.TimeDistributionStat{}
+	index := make(map[int64]int)
+	for t := r.From; t.Before(r.To); t = nextBucket(t, r.Granularity) {
+		index[t.Unix()] = len(stats)
+		stats = append(stats, models.TimeDistributionStat{
+			Time:  t.Format(layout),
+			Start: t,
+		})
+	}
+	for _, count := range counts {
+		if i, ok := index[bucketStart(count.Bucket, r.Granularity, r.Location).Unix()]; ok {
+			stats[i].Count += count.Clicks
+		}
+	}
+
+	sketches := make([]*hll.Sketch, len(stats))
+	for _, v := range visitors {
+		i, ok := index[bucketStart(v.Bucket, r.Granularity, r.Location).Unix()]
+		if !ok {
+			continue
+		}
+		if sketches[i] == nil {
+			sketches[i] = hll.New()
+		}
+		sketches[i].Merge(v.Sketch)
+	}
+	for i, sketch := range sketches {
+		if sketch != nil {
+			stats[i].UniqueVisitors = int(sketch.Count())
+		}
+	}
+	return stats
+}
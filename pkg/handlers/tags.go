@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxLinkTags       = 10
+	maxTagLength      = 50
+	maxCampaignLength = 100
+
+	// groupTopLinks 標籤或活動統計中列出的點擊數最多的短網址數量
+	groupTopLinks = 10
+)
+
+// normalizeTag 標準化標籤：去除前後空白並轉為小寫，返回給使用者的錯誤訊息
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", errors.New("tags must not be empty")
+	}
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return "", fmt.Errorf("tags must be at most %d characters", maxTagLength)
+	}
+	// 逗號用於 CSV 中分隔多個標籤
+	if strings.ContainsFunc(tag, func(r rune) bool { return r == ',' || r == '/' || unicode.IsControl(r) }) {
+		return "", fmt.Errorf("tag %q must not contain commas, slashes or control characters", tag)
+	}
+	return tag, nil
+}
+
+// normalizeTags 標準化標籤並去除重複，依名稱排序
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxLinkTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxLinkTags)
+	}
+	slices.Sort(normalized)
+	return normalized, nil
+}
+
+// normalizeCampaign 標準化活動名稱，空字串表示未分組
+func normalizeCampaign(campaign string) (string, error) {
+	campaign = strings.TrimSpace(campaign)
+	if utf8.RuneCountInString(campaign) > maxCampaignLength {
+		return "", fmt.Errorf("campaign must be at most %d characters", maxCampaignLength)
+	}
+	if strings.ContainsFunc(campaign, func(r rune) bool { return r == '/' || unicode.IsControl(r) }) {
+		return "", errors.New("campaign must not contain slashes or control characters")
+	}
+	return campaign, nil
+}
+
+// pathParam 取得解碼後的路徑參數（標籤及活動名稱可能包含空白或非 ASCII 字元）
+func pathParam(c *fiber.Ctx, name string) string {
+	value := c.Params(name)
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
+
+// ListTags 列出標籤及各標籤的短網址數、總點擊數（需認證，篩選參數同 ListLinks）
+func (h *Handler) ListTags(c *fiber.Ctx) error {
+	return h.listGroups(c, db.URLGroupTag)
+}
+
+// ListCampaigns 列出活動及各活動的短網址數、總點擊數（需認證，篩選參數同 ListLinks）
+func (h *Handler) ListCampaigns(c *fiber.Ctx) error {
+	return h.listGroups(c, db.URLGroupCampaign)
+}
+
+// GetTagStats 取得單一標籤的彙總統計及點擊數最多的短網址
+func (h *Handler) GetTagStats(c *fiber.Ctx) error {
+	tag, err := normalizeTag(pathParam(c, "tag"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return h.getGroupStats(c, db.URLGroupTag, tag)
+}
+
+// GetCampaignStats 取得單一活動的彙總統計及點擊數最多的短網址
+func (h *Handler) GetCampaignStats(c *fiber.Ctx) error {
+	campaign, err := normalizeCampaign(pathParam(c, "campaign"))
+	if err == nil && campaign == "" {
+		err = errors.New("Campaign is required")
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return h.getGroupStats(c, db.URLGroupCampaign, campaign)
+}
+
+// listGroups 依標籤或活動分組統計目前使用者可見的短網址
+func (h *Handler) listGroups(c *fiber.Ctx, by string) error {
+	filter, err := parseLinkFilter(c)
+	if err != nil {
+		return respondLinkFilterError(c, err)
+	}
+
+	groups, err := h.store.ListURLGroups(c.UserContext(), filter, by)
+	if err != nil {
+		log.Printf("Error listing URL groups by %s: %v", by, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if groups == nil {
+		groups = []models.GroupStat{}
+	}
+	return c.JSON(groups)
+}
+
+// getGroupStats 取得單一標籤或活動的統計，沒有符合的短網址時返回 404
+func (h *Handler) getGroupStats(c *fiber.Ctx, by, name string) error {
+	filter, err := parseLinkFilter(c)
+	if err != nil {
+		return respondLinkFilterError(c, err)
+	}
+	if by == db.URLGroupTag {
+		filter.Tag = name
+	} else {
+		filter.Campaign = name
+	}
+
+	ctx := c.UserContext()
+
+	// 以標籤分組時會一併統計這些短網址的其他標籤，只取指定的標籤
+	groups, err := h.store.ListURLGroups(ctx, filter, by)
+	if err != nil {
+		log.Printf("Error querying URL group stats by %s: %v", by, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	index := slices.IndexFunc(groups, func(group models.GroupStat) bool { return group.Name == name })
+	if index < 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": fmt.Sprintf("No links found in %s %q", by, name),
+		})
+	}
+
+	filter.Sort = db.URLSortClicks
+	filter.Asc = false
+	filter.After = nil
+	filter.Limit = groupTopLinks
+	topLinks, err := h.store.ListURLs(ctx, filter)
+	if err != nil {
+		log.Printf("Error querying top links by %s: %v", by, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	baseURL := requestBaseURL(c)
+	for i := range topLinks {
+		topLinks[i].ShortURL = newShortenResponse(&topLinks[i].URL, baseURL).ShortURL
+	}
+	if topLinks == nil {
+		topLinks = []models.LinkSummary{}
+	}
+
+	return c.JSON(models.GroupStatsResponse{
+		GroupStat: groups[index],
+		TopLinks:  topLinks,
+	})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-shorturl/pkg/models"
+)
+
+const (
+	maxRedirectRules   = 20
+	maxRuleNameLength  = 100
+	maxRuleCountries   = 50
+	defaultTargetLabel = "default"
+
+	// geoTargetingTimeout 重定向時查詢國家的超時，超時則視為未知國家
+	geoTargetingTimeout = time.Second
+)
+
+// ruleDevices 規則可用的設備類別
+var ruleDevices = map[string]bool{
+	"mobile":  true,
+	"tablet":  true,
+	"desktop": true,
+}
+
+// ruleOSes 規則可用的操作系統
+var ruleOSes = map[string]bool{
+	"ios":      true,
+	"android":  true,
+	"windows":  true,
+	"macos":    true,
+	"linux":    true,
+	"chromeos": true,
+}
+
+// visitorInfo 評估重定向規則時使用的訪客資訊
+type visitorInfo struct {
+	Device  string // mobile、tablet、desktop，無法判斷時為空字串
+	OS      string // ios、android、windows、macos、linux、chromeos，無法判斷時為空字串
+	Country string // ISO 3166-1 二位國家代碼，只有規則需要時才查詢，無法判斷時為空字串
+}
+
+// newVisitorInfo 從 User-Agent 解析訪客資訊
+func newVisitorInfo(userAgent string) visitorInfo {
+	return visitorInfo{
+		Device: deviceCategory(parseDeviceType(userAgent)),
+		OS:     osFamily(parseOS(userAgent)),
+	}
+}
+
+// deviceCategory 將 parseDeviceType 的詳細分類歸為 mobile、tablet 或 desktop
+func deviceCategory(deviceType string) string {
+	switch deviceType {
+	case "iPhone", "iPod", "Android 手機", "其他手機":
+		return "mobile"
+	case "iPad", "Android 平板", "平板":
+		return "tablet"
+	case "Mac", "Windows PC", "Linux", "Chrome OS", "其他電腦":
+		return "desktop"
+	default:
+		return ""
+	}
+}
+
+// osFamily 將 parseOS 的結果（可能包含版本號）歸為操作系統家族
+func osFamily(os string) string {
+	switch {
+	case strings.HasPrefix(os, "iOS"):
+		return "ios"
+	case strings.HasPrefix(os, "Android"):
+		return "android"
+	case strings.HasPrefix(os, "Windows"):
+		return "windows"
+	case strings.HasPrefix(os, "macOS"):
+		return "macos"
+	case strings.HasPrefix(os, "Chrome OS"):
+		return "chromeos"
+	case strings.HasPrefix(os, "Linux"):
+		return "linux"
+	default:
+		return ""
+	}
+}
+
+// ruleMatches 檢查訪客是否符合規則的所有條件
+func ruleMatches(rule models.RedirectRule, visitor visitorInfo) bool {
+	if rule.Device != "" && rule.Device != visitor.Device {
+		return false
+	}
+	if rule.OS != "" && rule.OS != visitor.OS {
+		return false
+	}
+	if len(rule.Countries) > 0 && !slices.Contains(rule.Countries, visitor.Country) {
+		return false
+	}
+	return true
+}
+
+// hasCountryRules 檢查是否有需要訪客國家的規則
+func hasCountryRules(rules []models.RedirectRule) bool {
+	for _, rule := range rules {
+		if len(rule.Countries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isCountryCode 檢查是否為二位大寫字母的國家代碼
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// selectDestination 依序評估重定向規則，返回目標網址及命中的規則名稱（未命中時為空字串）
+func selectDestination(link *models.URL, visitor visitorInfo) (string, string) {
+	for _, rule := range link.Rules {
+		if ruleMatches(rule, visitor) {
+			return rule.Destination, rule.Name
+		}
+	}
+	return link.OriginalURL, ""
+}
+
+// normalizeRedirectRules 標準化並驗證重定向規則，返回給使用者的錯誤訊息
+func normalizeRedirectRules(rules []models.RedirectRule) error {
+	if len(rules) > maxRedirectRules {
+		return fmt.Errorf("at most %d rules are allowed", maxRedirectRules)
+	}
+
+	names := make(map[string]bool)
+	for i := range rules {
+		rule := &rules[i]
+		rule.Device = strings.ToLower(strings.TrimSpace(rule.Device))
+		rule.OS = strings.ToLower(strings.TrimSpace(rule.OS))
+		rule.Name = strings.TrimSpace(rule.Name)
+
+		for j, country := range rule.Countries {
+			rule.Countries[j] = strings.ToUpper(strings.TrimSpace(country))
+			if !isCountryCode(rule.Countries[j]) {
+				return fmt.Errorf("rule %d: countries must be ISO 3166-1 alpha-2 codes", i+1)
+			}
+		}
+		if len(rule.Countries) > maxRuleCountries {
+			return fmt.Errorf("rule %d: at most %d countries are allowed", i+1, maxRuleCountries)
+		}
+
+		if rule.Device == "" && rule.OS == "" && len(rule.Countries) == 0 {
+			return fmt.Errorf("rule %d must have at least one condition", i+1)
+		}
+		if rule.Device != "" && !ruleDevices[rule.Device] {
+			return fmt.Errorf("rule %d: device must be one of mobile, tablet, desktop", i+1)
+		}
+		if rule.OS != "" && !ruleOSes[rule.OS] {
+			return fmt.Errorf("rule %d: os must be one of ios, android, windows, macos, linux, chromeos", i+1)
+		}
+
+		// 與建立短網址時相同的標準化及驗證
+		rule.Destination = normalizeURL(rule.Destination)
+		if !isValidURL(rule.Destination) {
+			return fmt.Errorf("rule %d: invalid destination URL", i+1)
+		}
+
+		// 未命名時以條件命名，例如 mobile-ios、DE-AT
+		if rule.Name == "" {
+			var parts []string
+			for _, part := range []string{rule.Device, rule.OS} {
+				if part != "" {
+					parts = append(parts, part)
+				}
+			}
+			parts = append(parts, rule.Countries...)
+			rule.Name = strings.Join(parts, "-")
+		}
+		if utf8.RuneCountInString(rule.Name) > maxRuleNameLength {
+			return fmt.Errorf("rule %d: name must be at most %d characters", i+1, maxRuleNameLength)
+		}
+		if rule.Name == defaultTargetLabel {
+			return fmt.Errorf("rule %d: name %q is reserved", i+1, defaultTargetLabel)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %d: duplicate rule name %q", i+1, rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
@@ -2,26 +2,28 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"go-shorturl/pkg/botdetect"
 	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/geo"
 	"go-shorturl/pkg/models"
+	"go-shorturl/pkg/rollup"
+	"go-shorturl/pkg/safehttp"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 )
 
 // isValidURL 驗證 URL 格式
@@ -43,126 +45,136 @@ func normalizeURL(rawURL string) string {
 	return rawURL
 }
 
-// generateShortCode 產生隨機短碼
-func generateShortCode(originalURL string) (string, error) {
-	// 計算原始網址長度（不包含協議）
-	urlWithoutProtocol := originalURL
-	if strings.HasPrefix(urlWithoutProtocol, "https://") {
-		urlWithoutProtocol = strings.TrimPrefix(urlWithoutProtocol, "https://")
-	} else if strings.HasPrefix(urlWithoutProtocol, "http://") {
-		urlWithoutProtocol = strings.TrimPrefix(urlWithoutProtocol, "http://")
+// maxCodeAttempts 自動產生短碼與既有短碼衝突時的最大嘗試次數
+const maxCodeAttempts = 5
+
+// createWithGeneratedCode 以自動產生的短碼建立短網址
+// 序號產生的短碼不會重複發放，但仍可能與使用者先前自訂的短碼相同，此時改用下一個短碼
+func (h *Handler) createWithGeneratedCode(ctx context.Context, u *models.URL) error {
+	for attempt := 1; ; attempt++ {
+		shortCode, err := h.codes.Generate(ctx)
+		if err != nil {
+			return err
+		}
+
+		u.ShortCode = shortCode
+		err = h.store.CreateURL(ctx, u)
+		if !errors.Is(err, db.ErrShortCodeExists) || attempt >= maxCodeAttempts {
+			return err
+		}
+		log.Printf("Generated short code %s already taken, retrying", shortCode)
 	}
+}
 
-	originalLength := len(urlWithoutProtocol)
+// newLinkFromRequest 驗證建立短網址的請求並轉換為短網址記錄（尚未產生短碼），返回給使用者的錯誤訊息
+func newLinkFromRequest(req *models.ShortenRequest, userID *uuid.UUID) (*models.URL, error) {
+	// 標準化 URL
+	normalizedURL := normalizeURL(req.URL)
 
-	// 短碼長度應該是原始長度的一半，但至少6個字符，最多12個字符
-	shortCodeLength := originalLength / 2
-	if shortCodeLength < 6 {
-		shortCodeLength = 6
-	} else if shortCodeLength > 12 {
-		shortCodeLength = 12
+	// 驗證 URL
+	if !isValidURL(normalizedURL) {
+		return nil, errors.New("Invalid URL format")
 	}
 
-	// 確保短碼比原始網址短
-	if shortCodeLength >= originalLength {
-		shortCodeLength = originalLength - 1
-		if shortCodeLength < 6 {
-			shortCodeLength = 6
+	// 驗證過期設定
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, errors.New("expires_at must be in the future")
 		}
+		utc := req.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+	var activeFrom *time.Time
+	if req.ActiveFrom != nil {
+		utc := req.ActiveFrom.UTC()
+		activeFrom = &utc
+	}
+	if err := validateSchedule(activeFrom, expiresAt, &req.PrelaunchURL); err != nil {
+		return nil, err
+	}
+	if req.MaxClicks != nil && *req.MaxClicks < 1 {
+		return nil, errors.New("max_clicks must be at least 1")
 	}
 
-	bytes := make([]byte, shortCodeLength)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+	// 驗證標籤及活動
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	campaign, err := normalizeCampaign(req.Campaign)
+	if err != nil {
+		return nil, err
 	}
-	return hex.EncodeToString(bytes)[:shortCodeLength], nil
-}
 
-// ShortenURL 建立短網址
-func ShortenURL(c *fiber.Ctx) error {
-	var req models.ShortenRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+	// 驗證自訂預覽信息
+	if err := normalizePreviewOverrides(&req.PreviewOverrides); err != nil {
+		return nil, err
 	}
 
-	// 標準化 URL
-	normalizedURL := normalizeURL(req.URL)
+	// 驗證重定向規則
+	if err := normalizeRedirectRules(req.Rules); err != nil {
+		return nil, err
+	}
 
-	// 驗證 URL
-	if !isValidURL(normalizedURL) {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid URL format",
-		})
+	// 驗證 A/B 測試目標
+	if err := normalizeVariants(req.Variants); err != nil {
+		return nil, err
 	}
 
-	// 決定短碼
-	var shortCode string
-	var err error
+	// 驗證重定向狀態碼及查詢參數傳遞方式
+	req.QueryPassthrough = strings.TrimSpace(req.QueryPassthrough)
+	if err := normalizeRedirectOptions(&req.RedirectStatus, req.QueryPassthrough); err != nil {
+		return nil, err
+	}
 
-	if req.CustomCode != "" {
-		// 檢查自訂短碼是否已存在
-		var exists bool
-		query := "SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)"
-		err = db.GetDB().QueryRow(context.Background(), query, req.CustomCode).Scan(&exists)
+	// 存取密碼只保存 bcrypt 雜湊值
+	var passwordHash string
+	if req.Password != "" {
+		hash, err := hashPassword(req.Password)
 		if err != nil {
-			log.Printf("Database error checking custom code: %v", err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": fmt.Sprintf("Database error: %v", err),
-			})
-		}
-		if exists {
-			return c.Status(409).JSON(fiber.Map{
-				"error": "Custom code already exists",
-			})
-		}
-		shortCode = req.CustomCode
-	} else {
-		// 產生隨機短碼
-		for {
-			shortCode, err = generateShortCode(normalizedURL)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"error": "Failed to generate short code",
-				})
-			}
-
-			// 檢查短碼是否已存在
-			var exists bool
-			query := "SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)"
-			err = db.GetDB().QueryRow(context.Background(), query, shortCode).Scan(&exists)
-			if err != nil {
-				log.Printf("Database error checking short code: %v", err)
-				return c.Status(500).JSON(fiber.Map{
-					"error": fmt.Sprintf("Database error: %v", err),
-				})
-			}
-			if !exists {
-				break
-			}
+			return nil, err
 		}
+		passwordHash = hash
 	}
 
-	// 插入新記錄
-	query := `
-		INSERT INTO urls (id, original_url, short_code, created_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at
-	`
-
-	id := uuid.New()
-	createdAt := time.Now()
+	return &models.URL{
+		ID:          uuid.New(),
+		UserID:      userID,
+		OriginalURL: normalizedURL,
+		ShortCode:   req.CustomCode,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   expiresAt,
+		MaxClicks:   req.MaxClicks,
+		Enabled:     true,
+
+		ActiveFrom:   activeFrom,
+		PrelaunchURL: req.PrelaunchURL,
+
+		Tags:     tags,
+		Campaign: campaign,
+
+		PreviewOverrides: req.PreviewOverrides,
+		Rules:            req.Rules,
+		Variants:         req.Variants,
+		PasswordHash:     passwordHash,
+		RedirectStatus:   req.RedirectStatus,
+		QueryPassthrough: req.QueryPassthrough,
+		PathForwarding:   req.PathForwarding,
+	}, nil
+}
 
-	err = db.GetDB().QueryRow(context.Background(), query, id, normalizedURL, shortCode, createdAt).Scan(&id, &createdAt)
-	if err != nil {
-		log.Printf("Error inserting URL: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": fmt.Sprintf("Failed to create short URL: %v", err),
-		})
+// insertLink 寫入短網址，已指定短碼（自訂短碼）時直接插入，自訂短碼已存在時返回 db.ErrShortCodeExists
+func (h *Handler) insertLink(ctx context.Context, u *models.URL) error {
+	if u.ShortCode != "" {
+		// 自訂短碼直接插入，由唯一鍵判斷是否已存在
+		return h.store.CreateURL(ctx, u)
 	}
+	return h.createWithGeneratedCode(ctx, u)
+}
 
-	// 構建短網址
+// requestBaseURL 短網址的域名，優先使用 BASE_URL 環境變數
+func requestBaseURL(c *fiber.Ctx) string {
 	baseURL := "http://localhost:8080"
 
 	// 嘗試從環境變數獲取域名
@@ -178,18 +190,79 @@ func ShortenURL(c *fiber.Ctx) error {
 			baseURL = fmt.Sprintf("%s://%s", protocol, host)
 		}
 	}
+	return baseURL
+}
 
-	// 統一使用 /url/ 格式
-	shortURL := fmt.Sprintf("%s/url/%s", baseURL, shortCode)
+// newShortenResponse 建立短網址的回應
+func newShortenResponse(u *models.URL, baseURL string) models.ShortenResponse {
+	return models.ShortenResponse{
+		// 統一使用 /url/ 格式
+		ShortURL:    fmt.Sprintf("%s/url/%s", baseURL, u.ShortCode),
+		OriginalURL: u.OriginalURL,
+		ShortCode:   u.ShortCode,
+		CreatedAt:   u.CreatedAt,
+		ExpiresAt:   u.ExpiresAt,
+		MaxClicks:   u.MaxClicks,
+
+		ActiveFrom:   u.ActiveFrom,
+		PrelaunchURL: u.PrelaunchURL,
+
+		Tags:     u.Tags,
+		Campaign: u.Campaign,
+
+		PreviewOverrides:  u.PreviewOverrides,
+		Rules:             u.Rules,
+		Variants:          u.Variants,
+		PasswordProtected: u.PasswordHash != "",
+		RedirectStatus:    u.RedirectStatus,
+		QueryPassthrough:  u.QueryPassthrough,
+		PathForwarding:    u.PathForwarding,
+	}
+}
 
-	response := models.ShortenResponse{
-		ShortURL:    shortURL,
-		OriginalURL: normalizedURL,
-		ShortCode:   shortCode,
-		CreatedAt:   createdAt,
+// canCreateLinks 設定 REQUIRE_API_KEY=true 時只允許已認證的使用者建立短網址
+func canCreateLinks(c *fiber.Ctx) bool {
+	return os.Getenv("REQUIRE_API_KEY") != "true" || currentUserID(c) != nil || isAdmin(c)
+}
+
+// ShortenURL 建立短網址
+func (h *Handler) ShortenURL(c *fiber.Ctx) error {
+	// 先檢查認證，未認證的請求不返回驗證錯誤的細節
+	if !canCreateLinks(c) {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "API key required",
+		})
+	}
+
+	var req models.ShortenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
 	}
 
-	return c.Status(201).JSON(response)
+	newURL, err := newLinkFromRequest(&req, currentUserID(c))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// 插入新記錄
+	err = h.insertLink(c.UserContext(), newURL)
+	if errors.Is(err, db.ErrShortCodeExists) && req.CustomCode != "" {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Custom code already exists",
+		})
+	}
+	if err != nil {
+		log.Printf("Error inserting URL: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to create short URL: %v", err),
+		})
+	}
+
+	return c.Status(201).JSON(newShortenResponse(newURL, requestBaseURL(c)))
 }
 
 // getRealIP 從 HTTP 頭中獲取真實 IP 地址
@@ -383,135 +456,6 @@ func parseOS(userAgent string) string {
 	return "其他"
 }
 
-// IPLocation IP地理位置信息
-type IPLocation struct {
-	Status      string `json:"status"`
-	Country     string `json:"country"`
-	Region      string `json:"regionName"`
-	City        string `json:"city"`
-	ISP         string `json:"isp"`
-	CountryCode string `json:"countryCode"`
-	Query       string `json:"query"`
-	Zip         string `json:"zip"`
-	Org         string `json:"org"`
-	AS          string `json:"as"`
-}
-
-// LocationDetails 詳細地理位置信息
-type LocationDetails struct {
-	Location   string // 簡化版本（用於向後兼容）
-	ISP        string
-	Hostname   string
-	Country    string
-	Region     string
-	City       string
-	Zip        string
-}
-
-// getIPLocation 查詢IP地理位置（使用ip-api.com免費API）
-func getIPLocation(ipAddress string) LocationDetails {
-	result := LocationDetails{
-		Location: "未知",
-	}
-
-	// 跳過本地IP和私有IP
-	if ipAddress == "" ||
-		strings.HasPrefix(ipAddress, "127.") ||
-		strings.HasPrefix(ipAddress, "192.168.") ||
-		strings.HasPrefix(ipAddress, "10.") ||
-		strings.HasPrefix(ipAddress, "172.") ||
-		ipAddress == "::1" ||
-		ipAddress == "localhost" {
-		result.Location = "本地"
-		return result
-	}
-
-	// 使用ip-api.com免費API（無需API key，但有速率限制）
-	// 添加更多字段：zip, org, as (用於hostname)
-	apiURL := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,country,regionName,city,isp,countryCode,zip,org,as,query&lang=zh-CN", ipAddress)
-
-	client := &http.Client{
-		Timeout: 2 * time.Second, // 設置超時，避免阻塞
-	}
-
-	resp, err := client.Get(apiURL)
-	if err != nil {
-		log.Printf("Error fetching IP location: %v", err)
-		return result
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return result
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading IP location response: %v", err)
-		return result
-	}
-
-	var location IPLocation
-	if err := json.Unmarshal(body, &location); err != nil {
-		log.Printf("Error parsing IP location: %v", err)
-		return result
-	}
-
-	// 檢查API返回狀態
-	if location.Status != "success" {
-		return result
-	}
-
-	// 填充詳細信息
-	result.ISP = location.ISP
-	result.Country = location.Country
-	result.Region = location.Region
-	result.City = location.City
-	result.Zip = location.Zip
-
-	// 嘗試通過反向DNS查詢獲取hostname
-	// 注意：這可能會增加查詢時間，所以設置較短的超時
-	hostnameChan := make(chan string, 1)
-	go func() {
-		hostnames, err := net.LookupAddr(ipAddress)
-		if err == nil && len(hostnames) > 0 {
-			hostnameChan <- hostnames[0]
-		} else {
-			hostnameChan <- ""
-		}
-	}()
-	
-	select {
-	case hostname := <-hostnameChan:
-		if hostname != "" {
-			// 移除末尾的點
-			result.Hostname = strings.TrimSuffix(hostname, ".")
-		}
-	case <-time.After(500 * time.Millisecond):
-		// 超時，不設置hostname
-	}
-
-	// 構建地理位置字符串（用於向後兼容）
-	parts := []string{}
-	if location.Country != "" {
-		parts = append(parts, location.Country)
-	}
-	if location.Region != "" && location.Region != location.Country {
-		parts = append(parts, location.Region)
-	}
-	if location.City != "" {
-		parts = append(parts, location.City)
-	}
-
-	if len(parts) > 0 {
-		result.Location = strings.Join(parts, ", ")
-	} else {
-		result.Location = "未知"
-	}
-
-	return result
-}
-
 // getRealReferrer 從 HTTP 頭中獲取真實 Referrer
 func getRealReferrer(c *fiber.Ctx) string {
 	// 優先從 X-Forwarded-Referer 獲取
@@ -541,42 +485,28 @@ func getRealReferrer(c *fiber.Ctx) string {
 	return ""
 }
 
-// isSocialMediaBot 檢測是否為社交媒體爬蟲
-func isSocialMediaBot(userAgent string) bool {
-	ua := strings.ToLower(userAgent)
-	// Facebook爬蟲
-	if strings.Contains(ua, "facebookexternalhit") ||
-		strings.Contains(ua, "facebot") {
-		return true
-	}
-	// Twitter爬蟲
-	if strings.Contains(ua, "twitterbot") {
-		return true
-	}
-	// LinkedIn爬蟲
-	if strings.Contains(ua, "linkedinbot") {
-		return true
-	}
-	// WhatsApp爬蟲
-	if strings.Contains(ua, "whatsapp") {
-		return true
-	}
-	// Telegram爬蟲
-	if strings.Contains(ua, "telegrambot") {
-		return true
-	}
-	// Slack爬蟲
-	if strings.Contains(ua, "slackbot") {
-		return true
-	}
-	// Discord爬蟲
-	if strings.Contains(ua, "discordbot") ||
-		strings.Contains(ua, "discord") {
-		return true
+// requestPurpose 取得瀏覽器預取或連結預覽請求的用途標頭
+func requestPurpose(c *fiber.Ctx) string {
+	for _, header := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		if value := c.Get(header); value != "" {
+			return value
+		}
 	}
-	return false
+	return ""
 }
 
+const (
+	ogFetchTimeout = 3 * time.Second // 抓取 OG 信息的總超時（包含重定向）
+	ogMaxRedirects = 3               // 最多跟隨幾次重定向
+	ogMaxBodySize  = 1024 * 1024     // 最多讀取 1MB
+)
+
+// ogClient 抓取 OG 信息專用的客戶端，拒絕連線到本地及私有位址
+var ogClient = safehttp.NewClient(safehttp.Config{
+	Timeout:      ogFetchTimeout,
+	MaxRedirects: ogMaxRedirects,
+})
+
 // OGMetadata 從目標URL抓取的Open Graph信息
 type OGMetadata struct {
 	Title       string
@@ -586,8 +516,8 @@ type OGMetadata struct {
 	SiteName    string
 }
 
-// fetchOGMetadata 從目標URL抓取Open Graph meta標籤
-func fetchOGMetadata(targetURL string) OGMetadata {
+// fetchOGMetadata 從目標URL抓取Open Graph meta標籤，抓取失敗時返回預設值及錯誤
+func fetchOGMetadata(targetURL string) (OGMetadata, error) {
 	metadata := OGMetadata{
 		Title:       "短網址服務",
 		Description: "點擊查看完整內容",
@@ -596,27 +526,35 @@ func fetchOGMetadata(targetURL string) OGMetadata {
 		SiteName:    "",
 	}
 
-	client := &http.Client{
-		Timeout: 3 * time.Second, // 設置超時
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), ogFetchTimeout)
+	defer cancel()
 
-	resp, err := client.Get(targetURL)
+	// 目標網址由使用者提供，只能連線到公開位址，避免被用來存取內部服務
+	resp, err := safehttp.Get(ctx, ogClient, targetURL, http.Header{
+		"Accept": []string{"text/html,application/xhtml+xml"},
+	})
 	if err != nil {
-		log.Printf("Error fetching OG metadata: %v", err)
-		return metadata
+		return metadata, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Error fetching OG metadata: status %d", resp.StatusCode)
-		return metadata
+		return metadata, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	// 只解析 HTML，其他類型（圖片、下載檔案等）直接使用預設值
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return metadata, fmt.Errorf("unsupported content type %q", resp.Header.Get("Content-Type"))
+	}
+	if resp.ContentLength > ogMaxBodySize {
+		return metadata, fmt.Errorf("response too large (%d bytes)", resp.ContentLength)
 	}
 
 	// 讀取HTML內容（限制大小，避免讀取過大文件）
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // 最多1MB
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ogMaxBodySize))
 	if err != nil {
-		log.Printf("Error reading OG metadata response: %v", err)
-		return metadata
+		return metadata, err
 	}
 
 	htmlContent := string(body)
@@ -661,6 +599,13 @@ func fetchOGMetadata(targetURL string) OGMetadata {
 		}
 	}
 
+	// 圖片只接受 http/https，避免反射 javascript: 等協議
+	if metadata.Image != "" {
+		if imageURL, err := url.Parse(metadata.Image); err != nil || safehttp.CheckURL(imageURL) != nil {
+			metadata.Image = ""
+		}
+	}
+
 	// 提取 og:type
 	if matches := extractMetaContent(htmlContent, `property=["']og:type["']\s+content=["']([^"']+)["']`); len(matches) > 0 {
 		metadata.Type = matches[0]
@@ -671,7 +616,7 @@ func fetchOGMetadata(targetURL string) OGMetadata {
 		metadata.SiteName = matches[0]
 	}
 
-	return metadata
+	return metadata, nil
 }
 
 // extractMetaContent 使用正則表達式提取meta標籤內容
@@ -684,89 +629,32 @@ func extractMetaContent(html, pattern string) []string {
 	return []string{}
 }
 
-// generateMetaHTML 生成包含Open Graph meta標籤的HTML頁面
-func generateMetaHTML(shortCode, originalURL, baseURL string) string {
-	// 從目標URL抓取Open Graph信息
-	ogMeta := fetchOGMetadata(originalURL)
-
-	// 構建完整的短網址URL
-	shortURL := fmt.Sprintf("%s/url/%s", baseURL, shortCode)
-
-	// 如果沒有圖片，使用默認圖片
-	imageURL := ogMeta.Image
-	if imageURL == "" {
-		imageURL = fmt.Sprintf("%s/og-image.png", baseURL)
+// isLinkExpired 檢查短網址是否已超過過期時間或點擊次數上限
+func isLinkExpired(link *models.URL, totalClicks int, now time.Time) bool {
+	if link.ExpiresAt != nil && !now.Before(*link.ExpiresAt) {
+		return true
 	}
+	return link.MaxClicks != nil && totalClicks >= *link.MaxClicks
+}
 
-	// 確保圖片URL是絕對路徑
-	if imageURL != "" && !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") {
-		if parsedURL, err := url.Parse(originalURL); err == nil {
-			if absImageURL, err := parsedURL.Parse(imageURL); err == nil {
-				imageURL = absImageURL.String()
-			} else {
-				// 如果解析失敗，嘗試拼接
-				if parsedURL.Scheme != "" && parsedURL.Host != "" {
-					baseURL := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
-					if strings.HasPrefix(imageURL, "/") {
-						imageURL = baseURL + imageURL
-					} else {
-						imageURL = baseURL + "/" + imageURL
-					}
-				}
-			}
+// sendExpiredPage 返回 410 Gone，若設定了 EXPIRED_PAGE_PATH 則返回該 HTML 頁面
+func sendExpiredPage(c *fiber.Ctx) error {
+	if pagePath := os.Getenv("EXPIRED_PAGE_PATH"); pagePath != "" {
+		page, err := os.ReadFile(pagePath)
+		if err == nil {
+			c.Set("Content-Type", "text/html; charset=utf-8")
+			return c.Status(410).Send(page)
 		}
+		log.Printf("Error reading expired page %s: %v", pagePath, err)
 	}
 
-	html := fmt.Sprintf(`<!DOCTYPE html>
-<html lang="zh-TW">
-<head>
-	<meta charset="UTF-8">
-	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	
-	<!-- Open Graph / Facebook -->
-	<meta property="og:type" content="%s">
-	<meta property="og:url" content="%s">
-	<meta property="og:title" content="%s">
-	<meta property="og:description" content="%s">
-	<meta property="og:image" content="%s">
-	%s
-	
-	<!-- Twitter -->
-	<meta property="twitter:card" content="summary_large_image">
-	<meta property="twitter:url" content="%s">
-	<meta property="twitter:title" content="%s">
-	<meta property="twitter:description" content="%s">
-	<meta property="twitter:image" content="%s">
-	
-	<!-- 標準meta標籤 -->
-	<meta name="description" content="%s">
-	<title>%s</title>
-	
-	<!-- 自動重定向 -->
-	<meta http-equiv="refresh" content="0;url=%s">
-	<script>window.location.href="%s";</script>
-</head>
-<body>
-	<p>正在跳轉到 <a href="%s">%s</a>...</p>
-</body>
-</html>`,
-		ogMeta.Type, shortURL, ogMeta.Title, ogMeta.Description, imageURL,
-		func() string {
-			if ogMeta.SiteName != "" {
-				return fmt.Sprintf(`<meta property="og:site_name" content="%s">`, ogMeta.SiteName)
-			}
-			return ""
-		}(),
-		shortURL, ogMeta.Title, ogMeta.Description, imageURL,
-		ogMeta.Description, ogMeta.Title,
-		originalURL, originalURL,
-		originalURL, originalURL)
-
-	return html
+	return c.Status(410).JSON(fiber.Map{
+		"error": "Short URL has expired",
+	})
 }
 
 // RedirectURL 重定向到原始網址
-func RedirectURL(c *fiber.Ctx) error {
+func (h *Handler) RedirectURL(c *fiber.Ctx) error {
 	shortCode := c.Params("short_code")
 	if shortCode == "" {
 		return c.Status(400).JSON(fiber.Map{
@@ -774,14 +662,12 @@ func RedirectURL(c *fiber.Ctx) error {
 		})
 	}
 
-	// 查詢原始網址
-	query := "SELECT id, original_url FROM urls WHERE short_code = $1"
-	var urlID uuid.UUID
-	var originalURL string
+	ctx := c.UserContext()
 
-	err := db.GetDB().QueryRow(context.Background(), query, shortCode).Scan(&urlID, &originalURL)
+	// 查詢原始網址
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, db.ErrNotFound) {
 			return c.Status(404).JSON(fiber.Map{
 				"error": "Short URL not found",
 			})
@@ -792,60 +678,126 @@ func RedirectURL(c *fiber.Ctx) error {
 		})
 	}
 
+	// 已刪除的短網址視為不存在，短碼之後有路徑時只有開啟路徑轉發的短網址才會匹配
+	forwardedPath := c.Params("*")
+	if link.DeletedAt != nil || (forwardedPath != "" && !link.PathForwarding) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Short URL not found",
+		})
+	}
+
+	// 已停用的短網址拒絕重定向
+	if !link.Enabled {
+		log.Printf("Short URL disabled - ShortCode: %s", shortCode)
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Short URL is disabled",
+		})
+	}
+
+	// 檢查是否已過期（只有設定了點擊上限才需要查詢點擊數）
+	// 使用非同步點擊佇列時，尚未寫入的點擊不計算在內，上限可能被短暫超過
+	totalClicks := 0
+	if link.MaxClicks != nil {
+		totalClicks, err = h.store.CountClicks(ctx, link.ID)
+		if err != nil {
+			log.Printf("Error counting clicks: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Database error",
+			})
+		}
+	}
+	if isLinkExpired(link, totalClicks, time.Now()) {
+		log.Printf("Short URL expired - ShortCode: %s", shortCode)
+		return sendExpiredPage(c)
+	}
+
+	// 尚未到開放時間時不重定向到目標網址，也不記錄點擊
+	if isLinkScheduled(link, time.Now()) {
+		log.Printf("Short URL not active yet - ShortCode: %s", shortCode)
+		return sendPrelaunchResponse(c, link)
+	}
+
+	// 受密碼保護的短網址需先輸入密碼（包含社交媒體爬蟲），解鎖前不記錄點擊
+	if link.PasswordHash != "" && !h.unlock.unlocked(c, link) {
+		return sendUnlockPage(c, 200, "")
+	}
+
 	// 記錄點擊 - 使用真實的客戶端信息
-	clickQuery := `
-		INSERT INTO clicks (id, url_id, clicked_at, ip_address, user_agent, referrer, device_type, location, 
-			location_isp, location_hostname, location_country, location_region, location_city, location_zip)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-	`
-
-	clickID := uuid.New()
-	clickedAt := time.Now()
-	ipAddress := getRealIP(c)                // 使用真實IP
-	userAgent := getRealUserAgent(c)         // 使用真實User-Agent
-	referrer := getRealReferrer(c)           // 使用真實Referrer
-	deviceType := parseDeviceType(userAgent) // 解析設備類型
-	locationDetails := getIPLocation(ipAddress) // 查詢詳細地理位置
+	// 只收集請求中的原始資訊，設備及地理位置等由背景處理，不影響重定向延遲
+	userAgent := getRealUserAgent(c) // 使用真實User-Agent
+	ipAddress := getRealIP(c)        // 使用真實IP
+
+	// 依訪客設備、操作系統及國家選擇目標網址
+	// 只有設定了國家規則才在請求中查詢地理位置（建議使用本地 MMDB），結果沿用到點擊記錄
+	visitor := newVisitorInfo(userAgent)
+	var location *geo.LocationDetails
+	if hasCountryRules(link.Rules) {
+		geoCtx, cancel := context.WithTimeout(ctx, geoTargetingTimeout)
+		details := geo.LookupLocation(geoCtx, h.geo, ipAddress)
+		cancel()
+		visitor.Country = details.CountryCode
+		location = &details
+	}
+	destination, target := selectDestination(link, visitor)
+
+	// 未命中規則的流量依權重分配到 A/B 測試目標，同一訪客固定分配到同一目標
+	var variant string
+	if target == "" && len(link.Variants) > 0 {
+		v := assignVariant(shortCode, link.Variants, c.Cookies(variantCookieName(shortCode)), ipAddress)
+		destination, variant = v.Destination, v.Name
+		setVariantCookie(c, shortCode, variant)
+	}
+
+	// 路徑轉發：/abc/guide/intro 重定向到目標網址之後加上 /guide/intro
+	if forwardedPath != "" {
+		forwarded, ok := appendPath(destination, forwardedPath)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid path",
+			})
+		}
+		destination = forwarded
+	}
+
+	// 依設定將訪客帶入的查詢參數（例如 utm_*、gclid）合併到目標網址
+	destination = mergeQuery(destination, string(c.Request().URI().QueryString()), link.QueryPassthrough)
 
 	// 記錄所有相關的HTTP頭以便調試（開發環境）
 	if os.Getenv("DEBUG") == "true" {
-		log.Printf("Click recorded - IP: %s, User-Agent: %s, Referrer: %s, Device: %s, Location: %s",
-			ipAddress, userAgent, referrer, deviceType, locationDetails.Location)
-		log.Printf("Location Details - ISP: %s, Country: %s, Region: %s, City: %s, Zip: %s, Hostname: %s",
-			locationDetails.ISP, locationDetails.Country, locationDetails.Region, locationDetails.City, locationDetails.Zip, locationDetails.Hostname)
 		log.Printf("HTTP Headers - X-Forwarded-For: %s, X-Real-IP: %s, X-Forwarded-User-Agent: %s",
 			c.Get("X-Forwarded-For"), c.Get("X-Real-IP"), c.Get("X-Forwarded-User-Agent"))
 	}
 
-	// 記錄點擊（地理位置查詢已設置超時，不會長時間阻塞）
-	_, err = db.GetDB().Exec(context.Background(), clickQuery, 
-		clickID, urlID, clickedAt, ipAddress, userAgent, referrer, deviceType, locationDetails.Location,
-		locationDetails.ISP, locationDetails.Hostname, locationDetails.Country, locationDetails.Region, 
-		locationDetails.City, locationDetails.Zip)
-	if err != nil {
-		log.Printf("Error recording click for short_code %s: %v", shortCode, err)
-		// 不返回錯誤，因為重定向仍然應該工作
-	} else {
-		// 轉換為東八區時間用於日誌
-		loc, _ := time.LoadLocation("Asia/Shanghai")
-		shanghaiTime := clickedAt.In(loc)
-		// 計算應該出現在哪個時間段（按小時分組）
-		timeSlot := shanghaiTime.Format("2006-01-02 15:00")
-		log.Printf("Click recorded - ShortCode: %s, Time (Shanghai): %s, Will appear in time slot: %s", 
-			shortCode, 
-			shanghaiTime.Format("2006-01-02 15:04:05"),
-			timeSlot)
-	}
-
-	// 檢測是否為社交媒體爬蟲
-	// 也檢查X-Forwarded-User-Agent，因為代理可能會修改User-Agent
-	forwardedUA := c.Get("X-Forwarded-User-Agent")
-	isBot := isSocialMediaBot(userAgent) || (forwardedUA != "" && isSocialMediaBot(forwardedUA))
+	// 檢測爬蟲、無頭瀏覽器、預取及連結掃描程式，點擊照常記錄但標記為爬蟲
+	bot, isBot := h.bots.Detect(botdetect.Request{
+		Method:    c.Method(),
+		UserAgent: userAgent,
+		IP:        ipAddress,
+		Purpose:   requestPurpose(c),
+	})
+
+	click := models.Click{
+		ID:        uuid.New(),
+		URLID:     link.ID,
+		ClickedAt: time.Now(),
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Referrer:  getRealReferrer(c), // 使用真實Referrer
+		Target:    target,
+		Variant:   variant,
+		IsBot:     isBot,
+		BotName:   bot.Name,
+	}
+	if location != nil {
+		setClickLocation(&click, *location)
+	}
+	h.recordClick(ctx, shortCode, click)
 
 	// 調試日誌（生產環境也可以保留，幫助排查問題）
-	log.Printf("User-Agent: %s, X-Forwarded-User-Agent: %s, IsBot: %v", userAgent, forwardedUA, isBot)
+	log.Printf("User-Agent: %s, IsBot: %v, Bot: %s", userAgent, isBot, bot.Name)
 
-	if isBot {
+	// 社交媒體爬蟲返回包含預覽信息的頁面
+	if bot.Preview {
 		// 獲取base URL
 		baseURL := "https://xsong.us"
 		if envBaseURL := os.Getenv("BASE_URL"); envBaseURL != "" {
@@ -864,17 +816,22 @@ func RedirectURL(c *fiber.Ctx) error {
 		log.Printf("Returning meta HTML for bot. BaseURL: %s, ShortCode: %s", baseURL, shortCode)
 
 		// 返回包含Open Graph meta標籤的HTML頁面
-		html := generateMetaHTML(shortCode, originalURL, baseURL)
+		html, err := h.generateMetaHTML(ctx, link, baseURL)
+		if err != nil {
+			// 預覽頁面無法生成時仍然重定向
+			log.Printf("Error rendering preview page for short_code %s: %v", shortCode, err)
+			return sendRedirect(c, link, destination)
+		}
 		c.Set("Content-Type", "text/html; charset=utf-8")
 		return c.SendString(html)
 	}
 
-	// 普通用戶直接302重定向
-	return c.Redirect(originalURL, 302)
+	// 普通用戶直接重定向
+	return sendRedirect(c, link, destination)
 }
 
 // GetStats 取得短網址統計
-func GetStats(c *fiber.Ctx) error {
+func (h *Handler) GetStats(c *fiber.Ctx) error {
 	shortCode := c.Params("short_code")
 	if shortCode == "" {
 		return c.Status(400).JSON(fiber.Map{
@@ -884,15 +841,12 @@ func GetStats(c *fiber.Ctx) error {
 
 	log.Printf("GetStats called for short_code: %s", shortCode)
 
-	// 查詢短網址基本資訊
-	urlQuery := "SELECT id, original_url, created_at FROM urls WHERE short_code = $1"
-	var urlID uuid.UUID
-	var originalURL string
-	var createdAt time.Time
+	ctx := c.UserContext()
 
-	err := db.GetDB().QueryRow(context.Background(), urlQuery, shortCode).Scan(&urlID, &originalURL, &createdAt)
+	// 查詢短網址基本資訊
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, db.ErrNotFound) {
 			return c.Status(404).JSON(fiber.Map{
 				"error": "Short URL not found",
 			})
@@ -902,340 +856,190 @@ func GetStats(c *fiber.Ctx) error {
 			"error": "Database error",
 		})
 	}
+	if !canViewStats(c, link) {
+		return respondForbidden(c)
+	}
+	urlID := link.ID
 
-	// 查詢總點擊數
-	var totalClicks int
-	clickCountQuery := "SELECT COUNT(*) FROM clicks WHERE url_id = $1"
-	err = db.GetDB().QueryRow(context.Background(), clickCountQuery, urlID).Scan(&totalClicks)
+	// 統計範圍（from、to、tz、granularity），預設為短網址建立至今
+	now := time.Now()
+	statsRange, err := resolveStatsRange(c, link, now)
 	if err != nil {
-		log.Printf("Error counting clicks: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Database error",
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
+	from, to := statsRange.From, statsRange.To
 
-	// 查詢裝置統計
-	deviceQuery := `
-		SELECT user_agent, COUNT(*) as count
-		FROM clicks
-		WHERE url_id = $1 AND user_agent IS NOT NULL AND user_agent != ''
-		GROUP BY user_agent
-		ORDER BY count DESC
-		LIMIT 10
-	`
-
-	deviceRows, err := db.GetDB().Query(context.Background(), deviceQuery, urlID)
+	// 預設排除爬蟲的點擊（include_bots=true 時包含）
+	includeBots, err := parseIncludeBots(c)
 	if err != nil {
-		log.Printf("Error querying device stats: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Database error",
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
-	defer deviceRows.Close()
 
-	var deviceStats []models.DeviceStat
-	for deviceRows.Next() {
-		var stat models.DeviceStat
-		err := deviceRows.Scan(&stat.UserAgent, &stat.Count)
-		if err != nil {
-			log.Printf("Error scanning device stat: %v", err)
-			continue
-		}
-		deviceStats = append(deviceStats, stat)
-	}
-
-	// 查詢來源統計
-	// 將空referrer和xsong.us的referrer都歸類為"直接訪問"
-	referrerQuery := `
-		SELECT 
-			CASE 
-				WHEN referrer IS NULL OR referrer = '' THEN '直接訪問'
-				WHEN referrer LIKE '%xsong.us%' THEN '直接訪問'
-				ELSE referrer
-			END as referrer, 
-			COUNT(*) as count
-		FROM clicks
-		WHERE url_id = $1
-		GROUP BY 
-			CASE 
-				WHEN referrer IS NULL OR referrer = '' THEN '直接訪問'
-				WHEN referrer LIKE '%xsong.us%' THEN '直接訪問'
-				ELSE referrer
-			END
-		ORDER BY count DESC
-		LIMIT 10
-	`
-
-	referrerRows, err := db.GetDB().Query(context.Background(), referrerQuery, urlID)
+	// details=true 時另外依 User-Agent 及 IP 統計（查詢整個範圍的原始點擊）
+	details, err := parseBoolQuery(c, "details")
 	if err != nil {
-		log.Printf("Error querying referrer stats: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Database error",
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
-	defer referrerRows.Close()
-
-	var referrerStats []models.ReferrerStat
-	for referrerRows.Next() {
-		var stat models.ReferrerStat
-		err := referrerRows.Scan(&stat.Referrer, &stat.Count)
-		if err != nil {
-			log.Printf("Error scanning referrer stat: %v", err)
-			continue
-		}
-		referrerStats = append(referrerStats, stat)
-	}
-
-	// 查詢IP地址統計
-	ipQuery := `
-		SELECT ip_address, COUNT(*) as count
-		FROM clicks
-		WHERE url_id = $1 AND ip_address IS NOT NULL AND ip_address != ''
-		GROUP BY ip_address
-		ORDER BY count DESC
-		LIMIT 20
-	`
 
-	ipRows, err := db.GetDB().Query(context.Background(), ipQuery, urlID)
+	// 各維度統計讀取彙總表，只有最近尚未彙總的點擊查詢原始記錄
+	breakdown, err := h.loadClickBreakdown(ctx, urlID, statsRange, includeBots)
 	if err != nil {
-		log.Printf("Error querying IP stats: %v", err)
+		log.Printf("Error querying click rollups: %v", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Database error",
 		})
 	}
-	defer ipRows.Close()
+	totalClicks := breakdown.total
 
+	// 查詢裝置及IP地址統計
+	var deviceStats []models.DeviceStat
 	var ipStats []models.IPStat
-	for ipRows.Next() {
-		var stat models.IPStat
-		err := ipRows.Scan(&stat.IPAddress, &stat.Count)
+	if details {
+		deviceStats, err = h.store.UserAgentStats(ctx, urlID, from, to, includeBots, 10)
 		if err != nil {
-			log.Printf("Error scanning IP stat: %v", err)
-			continue
+			log.Printf("Error querying device stats: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Database error",
+			})
 		}
-		ipStats = append(ipStats, stat)
-	}
-
-	// 查詢點擊時間分布（按小時，使用東八區時區）
-	// 將TIMESTAMP轉換為帶時區的時間戳（假設存儲為UTC），然後轉換為東八區
-	// 注意：16:40的點擊會出現在16:00這個時間段（按小時分組）
-	// 查詢所有點擊，不限制時間範圍，只限制返回的時間段數量
-	timeDistributionQuery := `
-		SELECT 
-			TO_CHAR((clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'Asia/Shanghai', 'YYYY-MM-DD HH24:00') as time_hour,
-			COUNT(*) as count
-		FROM clicks
-		WHERE url_id = $1
-		GROUP BY TO_CHAR((clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'Asia/Shanghai', 'YYYY-MM-DD HH24:00')
-		ORDER BY time_hour DESC
-		LIMIT 48
-	`
-
-	timeRows, err := db.GetDB().Query(context.Background(), timeDistributionQuery, urlID)
-	if err != nil {
-		log.Printf("Error querying time distribution: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Database error",
-		})
-	}
-	defer timeRows.Close()
 
-	var timeDistribution []models.TimeDistributionStat
-	for timeRows.Next() {
-		var stat models.TimeDistributionStat
-		err := timeRows.Scan(&stat.Time, &stat.Count)
+		ipStats, err = h.store.IPStats(ctx, urlID, from, to, includeBots, 20)
 		if err != nil {
-			log.Printf("Error scanning time distribution stat: %v", err)
-			continue
+			log.Printf("Error querying IP stats: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Database error",
+			})
 		}
-		timeDistribution = append(timeDistribution, stat)
-	}
-
-	// 調試日誌：記錄查詢到的時間分布
-	log.Printf("Time distribution query for short_code %s: found %d time slots", shortCode, len(timeDistribution))
-	if len(timeDistribution) > 0 {
-		log.Printf("  Latest time slot: %s (%d clicks)", timeDistribution[len(timeDistribution)-1].Time, timeDistribution[len(timeDistribution)-1].Count)
-		log.Printf("  Oldest time slot: %s (%d clicks)", timeDistribution[0].Time, timeDistribution[0].Count)
-	}
-
-	// 反轉時間分布順序，讓最早的在前
-	for i, j := 0, len(timeDistribution)-1; i < j; i, j = i+1, j-1 {
-		timeDistribution[i], timeDistribution[j] = timeDistribution[j], timeDistribution[i]
-	}
-
-	// 查詢設備類型統計
-	// 如果device_type為空，從user_agent重新解析
-	deviceTypeQuery := `
-		SELECT 
-			CASE 
-				WHEN device_type IS NOT NULL AND device_type != '' THEN device_type
-				ELSE '未知'
-			END as device_type,
-			COUNT(*) as count
-		FROM clicks
-		WHERE url_id = $1
-		GROUP BY 
-			CASE 
-				WHEN device_type IS NOT NULL AND device_type != '' THEN device_type
-				ELSE '未知'
-			END
-		ORDER BY count DESC
-	`
-
-	deviceTypeRows, err := db.GetDB().Query(context.Background(), deviceTypeQuery, urlID)
-	if err != nil {
-		log.Printf("Error querying device type stats: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Database error",
-		})
 	}
-	defer deviceTypeRows.Close()
 
-	var deviceTypeStats []models.DeviceTypeStat
-	deviceTypeMap := make(map[string]int)
-	
-	for deviceTypeRows.Next() {
-		var stat models.DeviceTypeStat
-		err := deviceTypeRows.Scan(&stat.DeviceType, &stat.Count)
-		if err != nil {
-			log.Printf("Error scanning device type stat: %v", err)
-			continue
-		}
-		deviceTypeMap[stat.DeviceType] += stat.Count
-	}
-
-	// 如果有很多"未知"，從user_agent重新解析
-	if unknownCount, ok := deviceTypeMap["未知"]; ok && unknownCount > 0 {
-		// 查詢所有device_type為空的記錄的user_agent
-		uaQuery := `
-			SELECT user_agent
-			FROM clicks
-			WHERE url_id = $1 AND (device_type IS NULL OR device_type = '')
-		`
-		uaRows, err := db.GetDB().Query(context.Background(), uaQuery, urlID)
-		if err == nil {
-			defer uaRows.Close()
-			for uaRows.Next() {
-				var userAgent string
-				if err := uaRows.Scan(&userAgent); err == nil && userAgent != "" {
-					deviceType := parseDeviceType(userAgent)
-					deviceTypeMap[deviceType]++
-					deviceTypeMap["未知"]--
-					if deviceTypeMap["未知"] <= 0 {
-						delete(deviceTypeMap, "未知")
-					}
-				}
-			}
-		}
+	// 來源統計（依來源網域）
+	var referrerStats []models.ReferrerStat
+	for _, kc := range topCounts(breakdown.referrers, 10) {
+		referrerStats = append(referrerStats, models.ReferrerStat{Referrer: kc.Key, Count: kc.Count})
 	}
 
-	// 轉換為切片
-	for deviceType, count := range deviceTypeMap {
-		if count > 0 {
-			deviceTypeStats = append(deviceTypeStats, models.DeviceTypeStat{
-				DeviceType: deviceType,
-				Count:      count,
+	// 點擊時間分布（依 tz 時區對齊時間段並補零），無法以整點彙總對齊時改用每分鐘的原始點擊
+	clickCounts, visitorSketches := breakdown.hourly, breakdown.visitorSketches
+	if !statsRange.hourAligned() {
+		clickCounts, err = h.store.MinuteClicks(ctx, urlID, from, to, includeBots)
+		if err == nil {
+			var visitors []db.ClickVisitor
+			visitors, err = h.store.ClickVisitors(ctx, db.ClickScope{URLID: &urlID, From: from, To: to}, time.Minute)
+			visitorSketches = rollup.Sketches(visitors)
+		}
+		if err != nil {
+			log.Printf("Error querying time distribution: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Database error",
 			})
 		}
 	}
+	timeDistribution := statsRange.timeSeries(clickCounts, visitorSketches)
 
-	// 按點擊數排序
-	for i := 0; i < len(deviceTypeStats)-1; i++ {
-		for j := i + 1; j < len(deviceTypeStats); j++ {
-			if deviceTypeStats[i].Count < deviceTypeStats[j].Count {
-				deviceTypeStats[i], deviceTypeStats[j] = deviceTypeStats[j], deviceTypeStats[i]
-			}
-		}
+	// 設備類型統計
+	var deviceTypeStats []models.DeviceTypeStat
+	for _, kc := range topCounts(breakdown.deviceTypes, 0) {
+		deviceTypeStats = append(deviceTypeStats, models.DeviceTypeStat{DeviceType: kc.Key, Count: kc.Count})
 	}
 
-	// 查詢地理位置統計
-	locationQuery := `
-		SELECT location, COUNT(*) as count
-		FROM clicks
-		WHERE url_id = $1 AND location IS NOT NULL AND location != '' AND location != '未知'
-		GROUP BY location
-		ORDER BY count DESC
-		LIMIT 20
-	`
+	// 地理位置統計（依國家）
+	var locationStats []models.LocationStat
+	for _, kc := range topCounts(breakdown.countries, 20, "", "未知") {
+		locationStats = append(locationStats, models.LocationStat{Location: kc.Key, Count: kc.Count})
+	}
 
-	locationRows, err := db.GetDB().Query(context.Background(), locationQuery, urlID)
-	if err != nil {
-		log.Printf("Error querying location stats: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Database error",
-		})
+	// 操作系統統計
+	var osStats []models.OSStat
+	for _, kc := range topCounts(breakdown.oses, 0) {
+		osStats = append(osStats, models.OSStat{OS: kc.Key, Count: kc.Count})
 	}
-	defer locationRows.Close()
 
-	var locationStats []models.LocationStat
-	for locationRows.Next() {
-		var stat models.LocationStat
-		err := locationRows.Scan(&stat.Location, &stat.Count)
-		if err != nil {
-			log.Printf("Error scanning location stat: %v", err)
-			continue
+	// 重定向規則統計，未命中規則的點擊歸為 "default"
+	targets := make(map[string]int, len(breakdown.targets))
+	for target, count := range breakdown.targets {
+		if target == "" {
+			target = "default"
 		}
-		locationStats = append(locationStats, stat)
+		targets[target] += count
+	}
+	var targetStats []models.TargetStat
+	for _, kc := range topCounts(targets, 0) {
+		targetStats = append(targetStats, models.TargetStat{Target: kc.Key, Count: kc.Count})
 	}
 
-	// 查詢操作系統統計（從user_agent解析）
-	osQuery := `
-		SELECT user_agent
-		FROM clicks
-		WHERE url_id = $1 AND user_agent IS NOT NULL AND user_agent != ''
-	`
+	// A/B 測試統計
+	var variantStats []models.VariantStat
+	for _, kc := range topCounts(breakdown.variants, 0) {
+		stat := models.VariantStat{Variant: kc.Key, Count: kc.Count}
+		if sketch := breakdown.variantVisitors[kc.Key]; sketch != nil {
+			stat.UniqueVisitors = int(sketch.Count())
+		}
+		variantStats = append(variantStats, stat)
+	}
 
-	osRows, err := db.GetDB().Query(context.Background(), osQuery, urlID)
-	if err != nil {
-		log.Printf("Error querying OS stats: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Database error",
-		})
+	// 爬蟲統計（依點擊數排序）
+	botClicks := 0
+	var botStats []models.BotStat
+	for _, kc := range topCounts(breakdown.bots, 0) {
+		botClicks += kc.Count
+		botStats = append(botStats, models.BotStat{Bot: kc.Key, Count: kc.Count})
 	}
-	defer osRows.Close()
 
-	// 統計操作系統
-	osCountMap := make(map[string]int)
-	for osRows.Next() {
-		var userAgent string
-		err := osRows.Scan(&userAgent)
+	// 剩餘點擊次數與重定向時相同，以包含爬蟲的所有點擊計算，不受統計範圍影響
+	lifetimeClicks := 0
+	if link.MaxClicks != nil {
+		lifetimeClicks, err = h.store.CountClicks(ctx, urlID)
 		if err != nil {
-			log.Printf("Error scanning user agent: %v", err)
-			continue
+			log.Printf("Error counting clicks: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Database error",
+			})
 		}
-		os := parseOS(userAgent)
-		osCountMap[os]++
 	}
 
-	// 轉換為切片並排序
-	var osStats []models.OSStat
-	for os, count := range osCountMap {
-		osStats = append(osStats, models.OSStat{
-			OS:    os,
-			Count: count,
-		})
-	}
-	// 按點擊數排序
-	for i := 0; i < len(osStats)-1; i++ {
-		for j := i + 1; j < len(osStats); j++ {
-			if osStats[i].Count < osStats[j].Count {
-				osStats[i], osStats[j] = osStats[j], osStats[i]
-			}
+	// 計算剩餘可用點擊次數
+	var remainingClicks *int
+	if link.MaxClicks != nil {
+		remaining := *link.MaxClicks - lifetimeClicks
+		if remaining < 0 {
+			remaining = 0
 		}
+		remainingClicks = &remaining
 	}
 
 	response := models.StatsResponse{
-		ShortCode:        shortCode,
-		OriginalURL:      originalURL,
-		TotalClicks:      totalClicks,
-		CreatedAt:        createdAt,
-		DeviceStats:      deviceStats,
-		ReferrerStats:    referrerStats,
-		IPStats:          ipStats,
-		TimeDistribution: timeDistribution,
-		DeviceTypeStats:  deviceTypeStats,
-		LocationStats:    locationStats,
-		OSStats:          osStats,
+		ShortCode:         shortCode,
+		OriginalURL:       link.OriginalURL,
+		TotalClicks:       totalClicks,
+		UniqueVisitors:    int(breakdown.visitors.Count()),
+		BotClicks:         botClicks,
+		CreatedAt:         link.CreatedAt,
+		ExpiresAt:         link.ExpiresAt,
+		MaxClicks:         link.MaxClicks,
+		RemainingClicks:   remainingClicks,
+		Expired:           isLinkExpired(link, lifetimeClicks, now),
+		ActiveFrom:        link.ActiveFrom,
+		Scheduled:         isLinkScheduled(link, now),
+		Range:             statsRange.model(),
+		IncludeBots:       includeBots,
+		DeviceStats:       deviceStats,
+		ReferrerStats:     referrerStats,
+		IPStats:           ipStats,
+		TimeDistribution:  timeDistribution,
+		DeviceTypeStats:   deviceTypeStats,
+		LocationStats:     locationStats,
+		OSStats:           osStats,
+		TargetStats:       targetStats,
+		VariantStats:      variantStats,
+		BotStats:          botStats,
+		PasswordProtected: link.PasswordProtected,
+		FailedUnlocks:     link.FailedUnlocks,
 	}
 
 	log.Printf("GetStats returning data for short_code: %s, total_clicks: %d", shortCode, totalClicks)
@@ -1243,7 +1047,7 @@ func GetStats(c *fiber.Ctx) error {
 }
 
 // GetClickList 取得點擊列表（詳細記錄）
-func GetClickList(c *fiber.Ctx) error {
+func (h *Handler) GetClickList(c *fiber.Ctx) error {
 	shortCode := c.Params("short_code")
 	if shortCode == "" {
 		return c.Status(400).JSON(fiber.Map{
@@ -1253,13 +1057,12 @@ func GetClickList(c *fiber.Ctx) error {
 
 	log.Printf("GetClickList called for short_code: %s", shortCode)
 
-	// 查詢短網址ID
-	urlQuery := "SELECT id FROM urls WHERE short_code = $1"
-	var urlID uuid.UUID
+	ctx := c.UserContext()
 
-	err := db.GetDB().QueryRow(context.Background(), urlQuery, shortCode).Scan(&urlID)
+	// 查詢短網址ID
+	link, err := h.store.GetURLByShortCode(ctx, shortCode)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if errors.Is(err, db.ErrNotFound) {
 			return c.Status(404).JSON(fiber.Map{
 				"error": "Short URL not found",
 			})
@@ -1269,53 +1072,81 @@ func GetClickList(c *fiber.Ctx) error {
 			"error": "Database error",
 		})
 	}
+	if !canViewStats(c, link) {
+		return respondForbidden(c)
+	}
+
+	// 時間範圍（from、to、tz），預設為短網址建立至今
+	r, err := parseTimeRange(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if r.From.IsZero() {
+		r.From = link.CreatedAt
+	}
+	if r.To.IsZero() {
+		r.To = time.Now()
+	}
+	includeBots, err := parseIncludeBots(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 
-	// 查詢點擊列表
-	// 轉換時間為東八區並格式化為字符串
-	clickListQuery := `
-		SELECT 
-			TO_CHAR((clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'Asia/Shanghai', 'YYYY-MM-DD HH24:MI:SS') as clicked_at,
-			COALESCE(ip_address, '') as ip_address,
-			COALESCE(location, '') as location,
-			COALESCE(device_type, '未知') as device_type,
-			COALESCE(location_isp, '') as location_isp,
-			COALESCE(location_hostname, '') as location_hostname,
-			COALESCE(location_country, '') as location_country,
-			COALESCE(location_region, '') as location_region,
-			COALESCE(location_city, '') as location_city,
-			COALESCE(location_zip, '') as location_zip
-		FROM clicks
-		WHERE url_id = $1
-		ORDER BY clicked_at DESC
-		LIMIT 1000
-	`
-
-	rows, err := db.GetDB().Query(context.Background(), clickListQuery, urlID)
+	limit := defaultClickListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxClickListLimit {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fmt.Sprintf("limit must be between 1 and %d", maxClickListLimit),
+			})
+		}
+		limit = n
+	}
+
+	// 查詢點擊列表（新到舊）
+	clicks, err := h.store.ListClicks(ctx, link.ID, r.From, r.To, includeBots, limit)
 	if err != nil {
 		log.Printf("Error querying click list: %v", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Database error",
 		})
 	}
-	defer rows.Close()
 
-	var clicks []models.ClickDetail
-	for rows.Next() {
-		var click models.ClickDetail
-		err := rows.Scan(&click.ClickedAt, &click.IPAddress, &click.Location, &click.DeviceType,
-			&click.LocationISP, &click.LocationHost, &click.LocationCountry, 
-			&click.LocationRegion, &click.LocationCity, &click.LocationZip)
-		if err != nil {
-			log.Printf("Error scanning click detail: %v", err)
-			continue
+	details := make([]models.ClickDetail, 0, len(clicks))
+	for _, click := range clicks {
+		deviceType := click.DeviceType
+		if deviceType == "" {
+			deviceType = "未知"
 		}
-		clicks = append(clicks, click)
+		details = append(details, models.ClickDetail{
+			ClickedAt:       click.ClickedAt.In(r.Location).Format("2006-01-02 15:04:05"),
+			IPAddress:       click.IPAddress,
+			Location:        click.Location,
+			DeviceType:      deviceType,
+			LocationISP:     click.LocationISP,
+			LocationHost:    click.LocationHostname,
+			LocationCountry: click.LocationCountry,
+			LocationRegion:  click.LocationRegion,
+			LocationCity:    click.LocationCity,
+			LocationZip:     click.LocationZip,
+			BotName:         click.BotName,
+		})
 	}
 
 	response := models.ClickListResponse{
 		ShortCode: shortCode,
-		Clicks:    clicks,
-		Total:     len(clicks),
+		Range: models.StatsRange{
+			From:     r.From.In(r.Location),
+			To:       r.To.In(r.Location),
+			Timezone: r.Location.String(),
+		},
+		IncludeBots: includeBots,
+		Clicks:      details,
+		Total:       len(details),
 	}
 
 	log.Printf("GetClickList returning data for short_code: %s, total: %d", shortCode, len(clicks))
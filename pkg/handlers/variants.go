@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-shorturl/pkg/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	minVariants          = 2
+	maxVariants          = 10
+	maxVariantWeight     = 1000
+	maxVariantNameLength = 100
+
+	// variantCookiePrefix 記錄訪客分配結果的 Cookie 名稱前綴，後接短碼
+	variantCookiePrefix = "variant_"
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// variantCookieName 短網址的分配結果 Cookie 名稱
+func variantCookieName(shortCode string) string {
+	return variantCookiePrefix + shortCode
+}
+
+// assignVariant 為訪客分配 A/B 測試目標
+// Cookie 中已分配且仍存在的目標優先，否則以短碼及訪客 IP 的雜湊依權重分配，同一 IP 的分配結果固定
+func assignVariant(shortCode string, variants []models.Variant, cookieValue, ipAddress string) models.Variant {
+	if name, err := url.QueryUnescape(cookieValue); err == nil && name != "" {
+		for _, v := range variants {
+			if v.Name == name {
+				return v
+			}
+		}
+	}
+
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(shortCode))
+	hash.Write([]byte{0})
+	hash.Write([]byte(ipAddress))
+	bucket := int(hash.Sum64() % uint64(total))
+
+	for _, v := range variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// setVariantCookie 記錄訪客的分配結果，權重調整後已分配的訪客仍維持原目標
+func setVariantCookie(c *fiber.Ctx, shortCode, name string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     variantCookieName(shortCode),
+		Value:    url.QueryEscape(name),
+		Path:     "/",
+		MaxAge:   int(variantCookieMaxAge.Seconds()),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// normalizeVariants 標準化並驗證 A/B 測試目標，返回給使用者的錯誤訊息
+func normalizeVariants(variants []models.Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) < minVariants || len(variants) > maxVariants {
+		return fmt.Errorf("variants must have between %d and %d entries", minVariants, maxVariants)
+	}
+
+	names := make(map[string]bool)
+	for i := range variants {
+		v := &variants[i]
+		v.Name = strings.TrimSpace(v.Name)
+
+		// 未指定權重時平均分配
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+		if v.Weight < 0 || v.Weight > maxVariantWeight {
+			return fmt.Errorf("variant %d: weight must be between 1 and %d", i+1, maxVariantWeight)
+		}
+
+		// 與建立短網址時相同的標準化及驗證
+		v.Destination = normalizeURL(v.Destination)
+		if !isValidURL(v.Destination) {
+			return fmt.Errorf("variant %d: invalid destination URL", i+1)
+		}
+
+		// 未命名時依順序命名為 A、B、C…
+		if v.Name == "" {
+			v.Name = string(rune('A' + i))
+		}
+		if utf8.RuneCountInString(v.Name) > maxVariantNameLength {
+			return fmt.Errorf("variant %d: name must be at most %d characters", i+1, maxVariantNameLength)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("variant %d: duplicate variant name %q", i+1, v.Name)
+		}
+		names[v.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+)
+
+// visitorHasher 計算訪客指紋：以金鑰及 UTC 日期對 IP 與 User-Agent 做 HMAC，
+// 不保存可還原的資訊，同一訪客在不同日期的指紋不同，無法跨日追蹤
+type visitorHasher struct {
+	key []byte
+}
+
+// visitorHasherFromEnv 依 VISITOR_SALT 建立訪客指紋計算器
+// 未設定時記錄錯誤並使用程序內的隨機金鑰，重新啟動或由其他實例處理的同一天訪客會被重複計算
+func visitorHasherFromEnv() *visitorHasher {
+	return &visitorHasher{key: secretFromEnv("VISITOR_SALT")}
+}
+
+// hash 計算訪客在 at 當天（UTC）的指紋，不會返回 0（0 表示未記錄）
+func (v *visitorHasher) hash(ip, userAgent string, at time.Time) int64 {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte(at.UTC().Format("2006-01-02") + "|" + ip + "|" + userAgent))
+	hash := int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+	if hash == 0 {
+		hash = 1
+	}
+	return hash
+}
@@ -0,0 +1,144 @@
+// Package hll 實作 HyperLogLog，以固定大小的 sketch 估算不重複元素數，多個 sketch 可合併
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// precision 以雜湊值前 precision 位元選擇暫存器，標準誤差約 1.04/sqrt(2^precision) ≈ 2.3%
+	precision = 11
+	registers = 1 << precision
+
+	formatSparse = 0 // 依序存放非零暫存器的索引（2 bytes）及值（1 byte）
+	formatDense  = 1 // 依序存放所有暫存器的值
+)
+
+// ErrInvalidSketch 序列化資料格式錯誤
+var ErrInvalidSketch = errors.New("invalid hll sketch")
+
+// Sketch HyperLogLog sketch，零值為空 sketch
+type Sketch struct {
+	registers []uint8 // 未加入任何元素前為 nil
+}
+
+// New 建立空 sketch
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add 加入一個元素的 64 位元雜湊值，雜湊值須均勻分布
+func (s *Sketch) Add(hash uint64) {
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+	index := hash >> (64 - precision)
+	rank := uint8(bits.LeadingZeros64(hash<<precision|1<<(precision-1))) + 1
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Merge 合併另一個 sketch，結果等同加入兩者的所有元素
+func (s *Sketch) Merge(other *Sketch) {
+	if other == nil || other.registers == nil {
+		return
+	}
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Count 估算不重複元素數
+func (s *Sketch) Count() uint64 {
+	if s.registers == nil {
+		return 0
+	}
+
+	sum, zeros := 0.0, 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// 元素較少時改用線性計數
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary 序列化 sketch，非零暫存器較少時使用稀疏格式
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	nonzero := 0
+	for _, rank := range s.registers {
+		if rank != 0 {
+			nonzero++
+		}
+	}
+
+	if nonzero*3 >= registers {
+		data := make([]byte, 2, 2+registers)
+		data[0], data[1] = precision, formatDense
+		return append(data, s.registers...), nil
+	}
+
+	data := make([]byte, 2, 2+nonzero*3)
+	data[0], data[1] = precision, formatSparse
+	for i, rank := range s.registers {
+		if rank != 0 {
+			data = binary.BigEndian.AppendUint16(data, uint16(i))
+			data = append(data, rank)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary 從 MarshalBinary 的結果還原 sketch，空資料視為空 sketch
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	s.registers = nil
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) < 2 || data[0] != precision {
+		return ErrInvalidSketch
+	}
+
+	body := data[2:]
+	switch data[1] {
+	case formatDense:
+		if len(body) != registers {
+			return ErrInvalidSketch
+		}
+		s.registers = append([]uint8(nil), body...)
+	case formatSparse:
+		if len(body)%3 != 0 {
+			return ErrInvalidSketch
+		}
+		if len(body) > 0 {
+			s.registers = make([]uint8, registers)
+		}
+		for i := 0; i < len(body); i += 3 {
+			index := binary.BigEndian.Uint16(body[i:])
+			if int(index) >= registers {
+				return ErrInvalidSketch
+			}
+			s.registers[index] = body[i+2]
+		}
+	default:
+		return ErrInvalidSketch
+	}
+	return nil
+}
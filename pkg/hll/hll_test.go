@@ -0,0 +1,151 @@
+package hll
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+// splitmix64 產生均勻分布的測試雜湊值
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// sketchOf 加入 [from, to) 的元素
+func sketchOf(from, to uint64) *Sketch {
+	s := New()
+	for i := from; i < to; i++ {
+		s.Add(splitmix64(i))
+	}
+	return s
+}
+
+// relativeError 估算值的相對誤差
+func relativeError(got uint64, want int) float64 {
+	return math.Abs(float64(got)-float64(want)) / float64(want)
+}
+
+func TestCountAccuracy(t *testing.T) {
+	// 三倍標準誤差
+	limit := 3 * 1.04 / math.Sqrt(registers)
+	for _, n := range []int{1000, 100000, 1000000} {
+		got := sketchOf(0, uint64(n)).Count()
+		if err := relativeError(got, n); err > limit {
+			t.Errorf("Count() = %d for %d elements, error %.2f%% > %.2f%%", got, n, err*100, limit*100)
+		}
+	}
+}
+
+func TestCountLinearRange(t *testing.T) {
+	if got := New().Count(); got != 0 {
+		t.Errorf("empty Count() = %d, want 0", got)
+	}
+
+	// 估算值不超過 2.5 倍暫存器數時改用線性計數，標準誤差為 sqrt(m(e^t-t-1))/n（t = n/m）
+	m := float64(registers)
+	for _, n := range []int{1, 10, 100, 1000, 5000} {
+		s := sketchOf(0, uint64(n))
+		// 重複加入不影響結果
+		for i := 0; i < n; i++ {
+			s.Add(splitmix64(uint64(i)))
+		}
+		ratio := float64(n) / m
+		limit := 3 * math.Sqrt(m*(math.Exp(ratio)-ratio-1)) / float64(n)
+		if got := s.Count(); relativeError(got, n) > limit {
+			t.Errorf("Count() = %d for %d elements, want within %.2f%%", got, n, limit*100)
+		}
+	}
+}
+
+func TestMergeEqualsUnion(t *testing.T) {
+	a := sketchOf(0, 60000)
+	b := sketchOf(40000, 100000)
+	union := sketchOf(0, 100000)
+
+	a.Merge(b)
+	a.Merge(nil)
+	a.Merge(New())
+	if !bytes.Equal(a.registers, union.registers) {
+		t.Fatal("merged registers differ from the union's registers")
+	}
+	if a.Count() != union.Count() {
+		t.Errorf("merged Count() = %d, union Count() = %d", a.Count(), union.Count())
+	}
+
+	empty := New()
+	empty.Merge(b)
+	if !bytes.Equal(empty.registers, b.registers) {
+		t.Error("merging into an empty sketch should copy the registers")
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		sketch *Sketch
+		format byte
+	}{
+		{"empty", New(), formatSparse},
+		{"sparse", sketchOf(0, 100), formatSparse},
+		{"dense", sketchOf(0, 100000), formatDense},
+	}
+	for _, tt := range tests {
+		data, err := tt.sketch.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary: %v", tt.name, err)
+		}
+		if data[0] != precision || data[1] != tt.format {
+			t.Errorf("%s: header %v, want precision %d format %d", tt.name, data[:2], precision, tt.format)
+		}
+
+		var got Sketch
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: UnmarshalBinary: %v", tt.name, err)
+		}
+		if got.Count() != tt.sketch.Count() {
+			t.Errorf("%s: Count() = %d after round trip, want %d", tt.name, got.Count(), tt.sketch.Count())
+		}
+		again, err := got.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary again: %v", tt.name, err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Errorf("%s: encoding changed after round trip", tt.name)
+		}
+	}
+
+	var empty Sketch
+	if err := empty.UnmarshalBinary(nil); err != nil || empty.Count() != 0 {
+		t.Errorf("UnmarshalBinary(nil) = %v, Count() %d, want empty sketch", err, empty.Count())
+	}
+}
+
+func TestUnmarshalRejectsInvalidData(t *testing.T) {
+	sparse, err := sketchOf(0, 100).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dense, err := sketchOf(0, 100000).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"header only":        {precision},
+		"other precision":    append([]byte{precision + 1}, dense[1:]...),
+		"unknown format":     {precision, 7},
+		"truncated dense":    dense[:len(dense)-1],
+		"truncated sparse":   sparse[:len(sparse)-1],
+		"sparse index range": {precision, formatSparse, 0xff, 0xff, 1},
+	}
+	for name, data := range tests {
+		var s Sketch
+		if err := s.UnmarshalBinary(data); !errors.Is(err, ErrInvalidSketch) {
+			t.Errorf("%s: UnmarshalBinary = %v, want ErrInvalidSketch", name, err)
+		}
+	}
+}
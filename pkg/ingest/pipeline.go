@@ -0,0 +1,243 @@
+package ingest
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-shorturl/pkg/models"
+)
+
+// BatchWriter 批次寫入點擊記錄
+type BatchWriter interface {
+	RecordClicks(ctx context.Context, clicks []models.Click) error
+}
+
+// Enricher 補充點擊記錄的衍生資訊（地理位置、設備、操作系統等），可能較慢
+type Enricher func(click *models.Click)
+
+// Config 點擊處理管線設定
+type Config struct {
+	QueueSize     int           // 緩衝區大小，滿了之後新的點擊會被丟棄
+	Workers       int           // 同時進行補充資訊的 worker 數量
+	BatchSize     int           // 累積多少筆後批次寫入
+	FlushInterval time.Duration // 最長多久寫入一次
+}
+
+// DefaultConfig 預設設定
+func DefaultConfig() Config {
+	return Config{
+		QueueSize:     10000,
+		Workers:       4,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+	}
+}
+
+// ConfigFromEnv 從環境變數讀取設定，未設定或格式錯誤的項目使用預設值
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if n, err := strconv.Atoi(os.Getenv("CLICK_QUEUE_SIZE")); err == nil && n > 0 {
+		cfg.QueueSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CLICK_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CLICK_BATCH_SIZE")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("CLICK_FLUSH_INTERVAL")); err == nil && d > 0 {
+		cfg.FlushInterval = d
+	}
+	return cfg
+}
+
+// Stats 管線運行指標
+type Stats struct {
+	Enqueued      uint64 `json:"enqueued"`       // 成功放入緩衝區的點擊數
+	Dropped       uint64 `json:"dropped"`        // 緩衝區已滿或管線已關閉而丟棄的點擊數
+	Written       uint64 `json:"written"`        // 成功寫入資料庫的點擊數
+	Failed        uint64 `json:"failed"`         // 寫入失敗的點擊數
+	Batches       uint64 `json:"batches"`        // 已執行的批次寫入次數
+	QueueLength   int    `json:"queue_length"`   // 目前緩衝區內的點擊數
+	QueueCapacity int    `json:"queue_capacity"` // 緩衝區容量
+}
+
+// Pipeline 非同步點擊處理管線：重定向只負責把點擊放入緩衝區，
+// 背景 worker 補充資訊後批次寫入資料庫
+type Pipeline struct {
+	cfg      Config
+	writer   BatchWriter
+	enrich   Enricher
+	queue    chan models.Click
+	enriched chan models.Click
+
+	mu     sync.RWMutex
+	closed bool
+
+	enrichWG sync.WaitGroup
+	writerWG sync.WaitGroup
+
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	written  atomic.Uint64
+	failed   atomic.Uint64
+	batches  atomic.Uint64
+}
+
+// NewPipeline 建立點擊處理管線，需要呼叫 Start 才會開始處理
+func NewPipeline(writer BatchWriter, enrich Enricher, cfg Config) *Pipeline {
+	defaults := DefaultConfig()
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaults.QueueSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaults.FlushInterval
+	}
+
+	return &Pipeline{
+		cfg:      cfg,
+		writer:   writer,
+		enrich:   enrich,
+		queue:    make(chan models.Click, cfg.QueueSize),
+		enriched: make(chan models.Click, cfg.BatchSize),
+	}
+}
+
+// Start 啟動背景 worker
+func (p *Pipeline) Start() {
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.enrichWG.Add(1)
+		go p.enrichLoop()
+	}
+	p.writerWG.Add(1)
+	go p.writeLoop()
+}
+
+// Enqueue 放入一筆點擊，不會阻塞；緩衝區已滿或管線已關閉時丟棄並返回 false
+func (p *Pipeline) Enqueue(click models.Click) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case p.queue <- click:
+		p.enqueued.Add(1)
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Close 停止接收新的點擊，處理並寫入緩衝區中剩餘的點擊；ctx 逾時則返回錯誤
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.enrichWG.Wait()
+		close(p.enriched)
+		p.writerWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		stats := p.Stats()
+		log.Printf("Click pipeline closed - written: %d, failed: %d, dropped: %d", stats.Written, stats.Failed, stats.Dropped)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 取得目前的運行指標
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Enqueued:      p.enqueued.Load(),
+		Dropped:       p.dropped.Load(),
+		Written:       p.written.Load(),
+		Failed:        p.failed.Load(),
+		Batches:       p.batches.Load(),
+		QueueLength:   len(p.queue),
+		QueueCapacity: cap(p.queue),
+	}
+}
+
+// enrichLoop 補充點擊資訊後交給寫入 worker
+func (p *Pipeline) enrichLoop() {
+	defer p.enrichWG.Done()
+	for click := range p.queue {
+		if p.enrich != nil {
+			p.enrich(&click)
+		}
+		p.enriched <- click
+	}
+}
+
+// writeLoop 累積點擊並批次寫入，達到批次大小或間隔時間時寫入
+func (p *Pipeline) writeLoop() {
+	defer p.writerWG.Done()
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Click, 0, p.cfg.BatchSize)
+	for {
+		select {
+		case click, ok := <-p.enriched:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush 寫入一個批次
+func (p *Pipeline) flush(batch []models.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p.batches.Add(1)
+	if err := p.writer.RecordClicks(ctx, batch); err != nil {
+		p.failed.Add(uint64(len(batch)))
+		log.Printf("Error writing click batch (%d clicks): %v", len(batch), err)
+		return
+	}
+	p.written.Add(uint64(len(batch)))
+}
@@ -13,22 +13,133 @@ type URL struct {
 	OriginalURL string    `json:"original_url" db:"original_url"`
 	ShortCode   string    `json:"short_code" db:"short_code"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"` // 過期時間，nil 表示永不過期
+	MaxClicks   *int       `json:"max_clicks,omitempty" db:"max_clicks"` // 點擊次數上限，nil 表示不限
+	Enabled     bool       `json:"enabled" db:"enabled"`                 // 是否啟用
+	DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"` // 軟刪除時間，nil 表示未刪除
+	UpdatedAt   *time.Time `json:"updated_at,omitempty" db:"updated_at"` // 最後修改時間
+
+	ActiveFrom   *time.Time `json:"active_from,omitempty" db:"active_from"`     // 開放時間，nil 表示立即開放
+	PrelaunchURL string     `json:"prelaunch_url,omitempty" db:"prelaunch_url"` // 開放前的目標網址，空字串表示顯示倒數頁面
+
+	Tags     []string `json:"tags,omitempty" db:"-"`            // 標籤（url_tags 表），依名稱排序
+	Campaign string   `json:"campaign,omitempty" db:"campaign"` // 所屬活動（資料夾），空字串表示未分組
+
+	PreviewOverrides
+	Rules       []RedirectRule `json:"rules,omitempty" db:"redirect_rules"` // 依訪客條件重定向的規則，依序評估
+	Variants    []Variant      `json:"variants,omitempty" db:"variants"`     // 未命中規則的流量依權重分配到各目標網址
+
+	RedirectStatus   int    `json:"redirect_status" db:"redirect_status"`               // 301、302、307 或 308
+	QueryPassthrough string `json:"query_passthrough,omitempty" db:"query_passthrough"` // 訪客查詢參數的傳遞方式：preserve、override，空字串表示不傳遞
+	PathForwarding   bool   `json:"path_forwarding,omitempty" db:"path_forwarding"`     // 是否將短碼之後的路徑附加到目標網址
+
+	PasswordHash      string `json:"-" db:"password_hash"`                         // 存取密碼的 bcrypt 雜湊值，空字串表示不需要密碼
+	PasswordProtected bool   `json:"password_protected,omitempty" db:"-"`          // 是否需要密碼，由 PasswordHash 推得
+	FailedUnlocks     int    `json:"failed_unlocks,omitempty" db:"failed_unlocks"` // 密碼錯誤次數
+}
+
+// RedirectRule 重定向規則：訪客符合所有已設定的條件（設備、操作系統、國家）時改為重定向到 Destination
+type RedirectRule struct {
+	Name        string `json:"name"`             // 規則名稱，記錄在點擊的 target 欄位
+	Device      string `json:"device,omitempty"` // mobile、tablet 或 desktop
+	OS          string `json:"os,omitempty"`     // ios、android、windows、macos、linux 或 chromeos
+	Countries   []string `json:"countries,omitempty"` // ISO 3166-1 二位國家代碼，符合任一即可
+	Destination string `json:"destination"`
+}
+
+// Variant A/B 測試的目標網址，同一訪客固定分配到同一個 Variant
+type Variant struct {
+	Name        string `json:"name"`        // 名稱，記錄在點擊的 variant 欄位
+	Destination string `json:"destination"`
+	Weight      int    `json:"weight"`      // 權重，流量依權重比例分配
+}
+
+// PreviewOverrides 自訂的社交媒體預覽信息，空字串表示使用從目標網頁抓取的內容
+type PreviewOverrides struct {
+	OGTitle       string `json:"og_title,omitempty" db:"og_title"`
+	OGDescription string `json:"og_description,omitempty" db:"og_description"`
+	OGImage       string `json:"og_image,omitempty" db:"og_image"`
+	TwitterCard   string `json:"twitter_card,omitempty" db:"twitter_card"` // summary、summary_large_image、app 或 player
+}
+
+// URLHistory 目標網址修改紀錄
+type URLHistory struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	URLID       uuid.UUID `json:"url_id" db:"url_id"`
+	OriginalURL string    `json:"original_url" db:"original_url"` // 被替換掉的舊目標網址
+	ReplacedAt  time.Time `json:"replaced_at" db:"replaced_at"`   // 被替換的時間
+}
+
+// LinkPreview 從目標網址抓取並快取的 Open Graph 信息
+type LinkPreview struct {
+	URLID       uuid.UUID `json:"url_id" db:"url_id"`
+	SourceURL   string    `json:"source_url" db:"source_url"` // 抓取時的目標網址，目標網址變更後快取失效
+	Title       string    `json:"title" db:"title"`
+	Description string    `json:"description" db:"description"`
+	Image       string    `json:"image" db:"image"`
+	Type        string    `json:"type" db:"type"`
+	SiteName    string    `json:"site_name" db:"site_name"`
+	FetchedAt   time.Time `json:"fetched_at" db:"fetched_at"`
+}
+
+// APIKey API 金鑰模型（只保存雜湊值，明文只在建立時返回一次）
+type APIKey struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	Name      string     `json:"name" db:"name"`
+	Prefix    string     `json:"prefix" db:"key_prefix"` // 金鑰前綴，方便辨識
+	KeyHash   string     `json:"-" db:"key_hash"`        // 金鑰的 SHA-256 雜湊值
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"` // 撤銷時間，nil 表示有效
 }
 
 // Click 點擊紀錄模型
 type Click struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	URLID     uuid.UUID `json:"url_id" db:"url_id"`
-	ClickedAt time.Time `json:"clicked_at" db:"clicked_at"`
-	IPAddress string    `json:"ip_address" db:"ip_address"`
-	UserAgent string    `json:"user_agent" db:"user_agent"`
-	Referrer  string    `json:"referrer" db:"referrer"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	URLID      uuid.UUID `json:"url_id" db:"url_id"`
+	ClickedAt  time.Time `json:"clicked_at" db:"clicked_at"`
+	InsertedAt time.Time `json:"-" db:"inserted_at"` // 寫入資料庫的時間，點擊彙總依此推進
+	IPAddress  string    `json:"ip_address" db:"ip_address"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	Referrer   string    `json:"referrer" db:"referrer"`
+
+	DeviceType       string `json:"device_type" db:"device_type"`
+	OS               string `json:"os" db:"os"`
+	Target           string `json:"target" db:"target"` // 命中的重定向規則名稱，空字串表示預設目標網址
+	Variant          string `json:"variant" db:"variant"` // 分配到的 A/B 測試目標名稱，空字串表示未參與分流
+	VisitorHash      int64  `json:"-" db:"visitor_hash"` // 訪客指紋（IP 及 User-Agent 的每日加鹽雜湊），0 表示未記錄
+	IsBot            bool   `json:"is_bot" db:"is_bot"`     // 是否為爬蟲、預取或連結掃描程式
+	BotName          string `json:"bot_name" db:"bot_name"` // 爬蟲名稱
+	Location         string `json:"location" db:"location"`
+	LocationISP      string `json:"location_isp" db:"location_isp"`
+	LocationHostname string `json:"location_hostname" db:"location_hostname"`
+	LocationCountry  string `json:"location_country" db:"location_country"`
+	LocationRegion   string `json:"location_region" db:"location_region"`
+	LocationCity     string `json:"location_city" db:"location_city"`
+	LocationZip      string `json:"location_zip" db:"location_zip"`
 }
 
 // ShortenRequest 建立短網址請求
 type ShortenRequest struct {
 	URL         string `json:"url" validate:"required,url"`
 	CustomCode  string `json:"custom_code,omitempty" validate:"omitempty,alphanum,max=16"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // 過期時間（RFC 3339）
+	MaxClicks   *int       `json:"max_clicks,omitempty" validate:"omitempty,min=1"` // 點擊次數上限
+
+	ActiveFrom   *time.Time `json:"active_from,omitempty"`   // 開放時間（RFC 3339），之前不會重定向到目標網址
+	PrelaunchURL string     `json:"prelaunch_url,omitempty"` // 開放前的目標網址，未設定時顯示倒數頁面
+
+	Tags     []string `json:"tags,omitempty"`     // 標籤
+	Campaign string   `json:"campaign,omitempty"` // 所屬活動（資料夾）
+
+	PreviewOverrides
+	Rules       []RedirectRule `json:"rules,omitempty"` // 重定向規則
+	Variants    []Variant      `json:"variants,omitempty"` // A/B 測試目標網址
+	Password    string         `json:"password,omitempty"` // 存取密碼，設定後需輸入密碼才會重定向
+
+	RedirectStatus   int    `json:"redirect_status,omitempty"`   // 重定向狀態碼，預設 302
+	QueryPassthrough string `json:"query_passthrough,omitempty"` // 訪客查詢參數的傳遞方式：preserve、override
+	PathForwarding   bool   `json:"path_forwarding,omitempty"`   // 將短碼之後的路徑附加到目標網址
 }
 
 // ShortenResponse 建立短網址回應
@@ -37,14 +148,148 @@ type ShortenResponse struct {
 	OriginalURL string    `json:"original_url"`
 	ShortCode   string    `json:"short_code"`
 	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	MaxClicks   *int       `json:"max_clicks,omitempty"`
+
+	ActiveFrom   *time.Time `json:"active_from,omitempty"`
+	PrelaunchURL string     `json:"prelaunch_url,omitempty"`
+
+	Tags     []string `json:"tags,omitempty"`
+	Campaign string   `json:"campaign,omitempty"`
+
+	PreviewOverrides
+	Rules       []RedirectRule `json:"rules,omitempty"`
+	Variants    []Variant      `json:"variants,omitempty"`
+
+	PasswordProtected bool   `json:"password_protected,omitempty"`
+	RedirectStatus    int    `json:"redirect_status"`
+	QueryPassthrough  string `json:"query_passthrough,omitempty"`
+	PathForwarding    bool   `json:"path_forwarding,omitempty"`
+}
+
+// BulkShortenResult 批次建立短網址的單筆結果
+type BulkShortenResult struct {
+	Row        int    `json:"row"`                   // 輸入中的第幾筆（從 1 開始，CSV 不含標題列）
+	URL        string `json:"url"`
+	CustomCode string `json:"custom_code,omitempty"`
+	ShortCode  string `json:"short_code,omitempty"`
+	ShortURL   string `json:"short_url,omitempty"`
+	Status     string `json:"status"`                // created、failed 或 skipped（整批模式中因其他筆失敗而未建立）
+	Error      string `json:"error,omitempty"`
+}
+
+// BulkShortenResponse 批次建立短網址回應
+type BulkShortenResponse struct {
+	Total   int                 `json:"total"`
+	Created int                 `json:"created"`
+	Failed  int                 `json:"failed"`
+	Results []BulkShortenResult `json:"results"`
+}
+
+// UpdateLinkRequest 修改短網址請求，未提供的欄位保持不變
+type UpdateLinkRequest struct {
+	OriginalURL *string `json:"original_url,omitempty"` // 新的目標網址
+	Enabled     *bool   `json:"enabled,omitempty"`      // 啟用或停用
+
+	// 自訂預覽信息，設為空字串表示改回使用抓取的內容
+	OGTitle       *string `json:"og_title,omitempty"`
+	OGDescription *string `json:"og_description,omitempty"`
+	OGImage       *string `json:"og_image,omitempty"`
+	TwitterCard   *string `json:"twitter_card,omitempty"`
+
+	// 重定向規則，提供時整組取代，空陣列表示清除
+	Rules *[]RedirectRule `json:"rules,omitempty"`
+
+	// A/B 測試目標網址，提供時整組取代，空陣列表示停止分流
+	Variants *[]Variant `json:"variants,omitempty"`
+
+	// 存取密碼，設為空字串表示移除密碼
+	Password *string `json:"password,omitempty"`
+
+	// 重定向狀態碼及訪客查詢參數的傳遞方式，傳遞方式設為空字串表示不傳遞
+	RedirectStatus   *int    `json:"redirect_status,omitempty"`
+	QueryPassthrough *string `json:"query_passthrough,omitempty"`
+	PathForwarding   *bool   `json:"path_forwarding,omitempty"`
+
+	// 開放時間及開放前的目標網址，開放前的目標網址設為空字串表示改為顯示倒數頁面
+	ActiveFrom   *time.Time `json:"active_from,omitempty"`
+	PrelaunchURL *string    `json:"prelaunch_url,omitempty"`
+
+	// 過期時間及點擊次數上限
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxClicks *int       `json:"max_clicks,omitempty"`
+
+	// 清除開放時間（立即開放）、過期時間或點擊次數上限，不可與對應的欄位同時提供
+	ClearActiveFrom bool `json:"clear_active_from,omitempty"`
+	ClearExpiresAt  bool `json:"clear_expires_at,omitempty"`
+	ClearMaxClicks  bool `json:"clear_max_clicks,omitempty"`
+
+	// 標籤（整組取代，空陣列表示清除）及所屬活動（空字串表示移出活動）
+	Tags     *[]string `json:"tags,omitempty"`
+	Campaign *string   `json:"campaign,omitempty"`
+}
+
+// LinkSummary 短網址列表中的一筆資料
+type LinkSummary struct {
+	URL
+	ShortURL    string `json:"short_url"`
+	TotalClicks int    `json:"total_clicks"`
+}
+
+// LinkListResponse 短網址列表回應
+type LinkListResponse struct {
+	Links      []LinkSummary `json:"links"`
+	NextCursor string        `json:"next_cursor,omitempty"` // 下一頁的游標，空字串表示沒有更多資料
+}
+
+// GroupStat 標籤或活動的彙總統計
+type GroupStat struct {
+	Name        string `json:"name"`
+	TotalLinks  int    `json:"total_links"`
+	TotalClicks int    `json:"total_clicks"`
+}
+
+// GroupStatsResponse 單一標籤或活動的統計回應
+type GroupStatsResponse struct {
+	GroupStat
+	TopLinks []LinkSummary `json:"top_links"` // 點擊數最多的短網址
+}
+
+// LinkHistoryResponse 目標網址修改紀錄回應
+type LinkHistoryResponse struct {
+	ShortCode   string       `json:"short_code"`
+	OriginalURL string       `json:"original_url"` // 目前的目標網址
+	History     []URLHistory `json:"history"`      // 過去的目標網址（新到舊）
+}
+
+// CreateAPIKeyRequest 建立 API 金鑰請求
+type CreateAPIKeyRequest struct {
+	Name   string     `json:"name,omitempty"`
+	UserID *uuid.UUID `json:"user_id,omitempty"` // 僅管理員可指定，未指定時建立新使用者
+}
+
+// CreateAPIKeyResponse 建立 API 金鑰回應
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"` // 金鑰明文，只會返回這一次
 }
 
 // StatsResponse 統計資料回應
 type StatsResponse struct {
 	ShortCode        string                `json:"short_code"`
 	OriginalURL      string                `json:"original_url"`
-	TotalClicks      int                   `json:"total_clicks"`
+	TotalClicks      int                   `json:"total_clicks"`              // 統計範圍內的點擊數
+	UniqueVisitors   int                   `json:"unique_visitors"`           // 統計範圍內的不重複訪客數（估算值）
+	BotClicks        int                   `json:"bot_clicks"`                // 統計範圍內爬蟲的點擊數（不論是否計入統計）
 	CreatedAt        time.Time             `json:"created_at"`
+	ExpiresAt        *time.Time            `json:"expires_at,omitempty"`      // 過期時間
+	MaxClicks        *int                  `json:"max_clicks,omitempty"`      // 點擊次數上限
+	RemainingClicks  *int                  `json:"remaining_clicks,omitempty"` // 剩餘可用點擊次數
+	Expired          bool                  `json:"expired"`                   // 是否已過期（時間或次數）
+	ActiveFrom       *time.Time            `json:"active_from,omitempty"`     // 開放時間
+	Scheduled        bool                  `json:"scheduled"`                 // 是否尚未到開放時間
+	Range            StatsRange            `json:"range"`                     // 統計的時間範圍
+	IncludeBots      bool                  `json:"include_bots"`              // 統計是否包含爬蟲的點擊
 	DeviceStats      []DeviceStat          `json:"device_stats"`
 	ReferrerStats    []ReferrerStat        `json:"referrer_stats"`
 	IPStats          []IPStat              `json:"ip_stats"`
@@ -52,6 +297,18 @@ type StatsResponse struct {
 	DeviceTypeStats  []DeviceTypeStat      `json:"device_type_stats"`
 	LocationStats    []LocationStat        `json:"location_stats"`
 	OSStats          []OSStat              `json:"os_stats"`
+	TargetStats      []TargetStat          `json:"target_stats"` // 依重定向規則分組
+	VariantStats     []VariantStat         `json:"variant_stats,omitempty"` // 依 A/B 測試目標分組
+	BotStats         []BotStat             `json:"bot_stats"`    // 依爬蟲名稱分組
+
+	PasswordProtected bool `json:"password_protected,omitempty"` // 是否需要密碼
+	FailedUnlocks     int  `json:"failed_unlocks,omitempty"`     // 密碼錯誤次數
+}
+
+// BotStat 爬蟲統計
+type BotStat struct {
+	Bot   string `json:"bot"`
+	Count int    `json:"count"`
 }
 
 // DeviceStat 裝置統計
@@ -74,8 +331,19 @@ type IPStat struct {
 
 // TimeDistributionStat 時間分布統計
 type TimeDistributionStat struct {
-	Time  string `json:"time"`  // 時間標籤，如 "2024-01-01" 或 "14:00"
-	Count int    `json:"count"` // 該時間段的點擊數
+	Time  string    `json:"time"`  // 時間標籤（依 tz 參數的時區），如 "2024-01-01" 或 "2024-01-01 14:00"
+	Start time.Time `json:"start"` // 時間段起點
+	Count int       `json:"count"` // 該時間段的點擊數
+
+	UniqueVisitors int `json:"unique_visitors"` // 該時間段的不重複訪客數（估算值）
+}
+
+// StatsRange 統計的時間範圍
+type StatsRange struct {
+	From        time.Time `json:"from"`                  // 起始時間（含）
+	To          time.Time `json:"to"`                    // 結束時間（不含）
+	Timezone    string    `json:"timezone"`              // IANA 時區名稱
+	Granularity string    `json:"granularity,omitempty"` // 時間分布的時間段：minute、hour、day、week 或 month
 }
 
 // DeviceTypeStat 設備類型統計
@@ -86,10 +354,23 @@ type DeviceTypeStat struct {
 
 // LocationStat 地理位置統計
 type LocationStat struct {
-	Location string `json:"location"` // 地理位置，如 "中國, 北京, 北京"
+	Location string `json:"location"` // 國家，如 "中國"
 	Count    int    `json:"count"`    // 該地理位置的點擊數
 }
 
+// TargetStat 重定向目標統計
+type TargetStat struct {
+	Target string `json:"target"` // 規則名稱，未命中規則時為 "default"
+	Count  int    `json:"count"`
+}
+
+// VariantStat A/B 測試目標統計
+type VariantStat struct {
+	Variant        string `json:"variant"`
+	Count          int    `json:"count"`           // 點擊數
+	UniqueVisitors int    `json:"unique_visitors"` // 不重複訪客數（依訪客指紋）
+}
+
 // OSStat 操作系統統計
 type OSStat struct {
 	OS    string `json:"os"`    // 操作系統，如 "macOS 10.15", "iOS 18.6", "Android 14"
@@ -98,7 +379,7 @@ type OSStat struct {
 
 // ClickDetail 點擊詳情
 type ClickDetail struct {
-	ClickedAt     string `json:"clicked_at"`      // 點擊時間（東八區格式字符串）
+	ClickedAt     string `json:"clicked_at"`      // 點擊時間（依 tz 參數的時區格式化）
 	IPAddress     string `json:"ip_address"`      // IP地址
 	Location      string `json:"location"`        // 地理位置（簡化版本）
 	DeviceType    string `json:"device_type"`     // 設備類型
@@ -108,11 +389,14 @@ type ClickDetail struct {
 	LocationRegion string `json:"location_region"`   // 地區／州
 	LocationCity   string `json:"location_city"`     // 城市
 	LocationZip    string `json:"location_zip"`      // 郵遞區號
+	BotName        string `json:"bot_name,omitempty"` // 爬蟲名稱（include_bots 時才會出現）
 }
 
 // ClickListResponse 點擊列表回應
 type ClickListResponse struct {
 	ShortCode string       `json:"short_code"`
+	Range     StatsRange   `json:"range"`
+	IncludeBots bool       `json:"include_bots"` // 是否包含爬蟲的點擊
 	Clicks    []ClickDetail `json:"clicks"`
 	Total     int          `json:"total"`
 }
@@ -0,0 +1,217 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/hll"
+)
+
+// maxChunk 每次彙總的最長時間範圍，避免長時間未執行後單次查詢過大
+const maxChunk = 24 * time.Hour
+
+// Store 彙總所需的資料庫操作
+type Store interface {
+	ClickGroups(ctx context.Context, scope db.ClickScope) ([]db.ClickGroup, error)
+	ClickVisitors(ctx context.Context, scope db.ClickScope, unit time.Duration) ([]db.ClickVisitor, error)
+	ClickRollupWatermark(ctx context.Context) (time.Time, error)
+	SaveClickRollups(ctx context.Context, rollups []db.ClickRollup, visitors []db.VisitorSketch, from, until time.Time) error
+}
+
+// Classifier 補全分組的設備類型、操作系統及來源等統計維度
+type Classifier func(group *db.ClickGroup)
+
+// Config 彙總設定
+type Config struct {
+	Interval time.Duration // 多久檢查一次是否有完整的小時可彙總
+	Delay    time.Duration // 整點後等待多久才彙總該小時寫入的點擊，讓進行中的寫入交易提交
+}
+
+// DefaultConfig 預設設定
+func DefaultConfig() Config {
+	return Config{
+		Interval: time.Minute,
+		Delay:    5 * time.Minute,
+	}
+}
+
+// ConfigFromEnv 從環境變數讀取設定，未設定或格式錯誤的項目使用預設值
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if d, err := time.ParseDuration(os.Getenv("ROLLUP_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ROLLUP_DELAY")); err == nil && d >= 0 {
+		cfg.Delay = d
+	}
+	return cfg
+}
+
+// Merge 補全分組的統計維度後合併相同維度的分組
+func Merge(groups []db.ClickGroup, classify Classifier) []db.ClickRollup {
+	index := make(map[db.ClickRollup]int)
+	var rollups []db.ClickRollup
+	for i := range groups {
+		group := groups[i]
+		if classify != nil {
+			classify(&group)
+		}
+		key := group.ClickRollup
+		key.Bucket = key.Bucket.UTC()
+		key.Clicks = 0
+		if j, ok := index[key]; ok {
+			rollups[j].Clicks += group.Clicks
+			continue
+		}
+		index[key] = len(rollups)
+		key.Clicks = group.Clicks
+		rollups = append(rollups, key)
+	}
+	return rollups
+}
+
+// Sketches 依短網址、時間段及 A/B 測試目標將訪客指紋加入 HyperLogLog sketch
+func Sketches(visitors []db.ClickVisitor) []db.VisitorSketch {
+	index := make(map[db.ClickVisitor]int)
+	var sketches []db.VisitorSketch
+	for _, v := range visitors {
+		key := db.ClickVisitor{URLID: v.URLID, Bucket: v.Bucket.UTC(), Variant: v.Variant}
+		i, ok := index[key]
+		if !ok {
+			i = len(sketches)
+			index[key] = i
+			sketches = append(sketches, db.VisitorSketch{URLID: key.URLID, Bucket: key.Bucket, Variant: key.Variant, Sketch: hll.New()})
+		}
+		sketches[i].Sketch.Add(uint64(v.VisitorHash))
+	}
+	return sketches
+}
+
+// Aggregator 背景彙總點擊：依寫入時間逐小時將點擊累加到（點擊時間所在的）每小時及每日彙總表
+// 點擊佇列延遲寫入的舊點擊也會在寫入後的下一輪計入
+type Aggregator struct {
+	cfg      Config
+	store    Store
+	classify Classifier
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// NewAggregator 建立彙總器，需要呼叫 Start 才會開始執行
+func NewAggregator(store Store, classify Classifier, cfg Config) *Aggregator {
+	defaults := DefaultConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	if cfg.Delay < 0 {
+		cfg.Delay = defaults.Delay
+	}
+
+	return &Aggregator{
+		cfg:      cfg,
+		store:    store,
+		classify: classify,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start 啟動背景彙總
+func (a *Aggregator) Start() {
+	a.wg.Add(1)
+	go a.loop()
+}
+
+// Close 停止背景彙總，等待進行中的彙總完成；ctx 逾時則返回錯誤
+func (a *Aggregator) Close(ctx context.Context) error {
+	a.once.Do(func() { close(a.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop 定期執行彙總
+func (a *Aggregator) loop() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		a.run()
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run 執行一輪彙總並記錄錯誤
+func (a *Aggregator) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := a.RunOnce(ctx, time.Now()); err != nil {
+		log.Printf("Error rolling up clicks: %v", err)
+	}
+}
+
+// RunOnce 彙總寫入時間在目前進度到 now 減去延遲後的整點之間的點擊
+// 其他程序已彙總同一段時間時停止本輪，不視為錯誤
+func (a *Aggregator) RunOnce(ctx context.Context, now time.Time) error {
+	target := now.Add(-a.cfg.Delay).UTC().Truncate(time.Hour)
+
+	from, err := a.store.ClickRollupWatermark(ctx)
+	if err != nil {
+		return err
+	}
+
+	for from.Before(target) {
+		until := from.Add(maxChunk)
+		if until.After(target) {
+			until = target
+		}
+
+		scope := db.ClickScope{InsertedFrom: from, InsertedUntil: until}
+		groups, err := a.store.ClickGroups(ctx, scope)
+		if err != nil {
+			return err
+		}
+		visitors, err := a.store.ClickVisitors(ctx, scope, time.Hour)
+		if err != nil {
+			return err
+		}
+		err = a.store.SaveClickRollups(ctx, Merge(groups, a.classify), Sketches(visitors), from, until)
+		if errors.Is(err, db.ErrRollupConflict) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		from = until
+
+		select {
+		case <-a.stop:
+			return nil
+		default:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package rollup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-shorturl/pkg/db"
+	"go-shorturl/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+func TestAggregatorCountsLateClicks(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	watermark, err := store.ClickRollupWatermark(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 點擊時間早於彙總進度，但在進度之後才寫入（例如點擊佇列延遲寫入）
+	urlID := uuid.New()
+	late := watermark.Add(-3 * time.Hour).Add(10 * time.Minute)
+	if err := store.RecordClick(ctx, &models.Click{URLID: urlID, ClickedAt: late, DeviceType: "Desktop", OS: "Linux"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAggregator(store, nil, Config{Delay: 5 * time.Minute})
+	if err := a.RunOnce(ctx, watermark.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := late.UTC().Truncate(time.Hour)
+	rollups, err := store.ListClickRollups(ctx, urlID, bucket, bucket.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clicks := 0
+	for _, r := range rollups {
+		clicks += r.Clicks
+	}
+	if clicks != 1 {
+		t.Fatalf("rolled up %d clicks in %s, want 1", clicks, bucket)
+	}
+
+	// 已彙總的點擊不會在下一輪重複累加
+	if err := a.RunOnce(ctx, watermark.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	rollups, err = store.ListClickRollups(ctx, urlID, bucket, bucket.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rollups) != 1 || rollups[0].Clicks != 1 {
+		t.Fatalf("rollups after second run = %+v, want 1 click", rollups)
+	}
+}
@@ -0,0 +1,137 @@
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrBlockedAddress 目標位址為本地、私有或保留位址
+	ErrBlockedAddress = errors.New("destination address is not allowed")
+	// ErrUnsupportedScheme 只允許 http 及 https
+	ErrUnsupportedScheme = errors.New("only http and https URLs are allowed")
+	// ErrTooManyRedirects 重定向次數超過上限
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// blockedPrefixes IsPublicIP 之外額外封鎖的保留網段
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // 本網路
+	netip.MustParsePrefix("100.64.0.0/10"),   // 電信級 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF 協定分配
+	netip.MustParsePrefix("192.0.2.0/24"),    // 文件範例
+	netip.MustParsePrefix("198.18.0.0/15"),   // 效能測試
+	netip.MustParsePrefix("198.51.100.0/24"), // 文件範例
+	netip.MustParsePrefix("203.0.113.0/24"),  // 文件範例
+	netip.MustParsePrefix("240.0.0.0/4"),     // 保留及廣播
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64，可能對應到內部 IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // 本地 NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // 文件範例
+	netip.MustParsePrefix("2002::/16"),       // 6to4，可能內嵌私有 IPv4
+	netip.MustParsePrefix("fec0::/10"),       // 已廢棄的站點本地位址
+}
+
+// IsPublicIP 檢查是否為可公開連線的位址（排除迴路、私有、鏈路本地、多播及保留位址）
+func IsPublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL 檢查 URL 的協議，主機位址在實際連線時才檢查
+func CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedScheme
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host in URL %q", u.String())
+	}
+	return nil
+}
+
+// Config 安全 HTTP 客戶端設定
+type Config struct {
+	Timeout      time.Duration // 整個請求（包含重定向）的超時
+	MaxRedirects int           // 最多跟隨幾次重定向
+}
+
+// NewClient 建立只能連線到公開位址的 HTTP 客戶端
+//
+// 位址檢查在 DNS 解析之後、實際建立連線時進行，每次重定向及每個解析結果都會檢查，
+// 因此無法透過 DNS rebinding 或重定向到內部位址繞過。不使用環境變數中的代理。
+func NewClient(cfg Config) *http.Client {
+	return newClient(cfg, IsPublicIP)
+}
+
+// newClient 建立只能連線到 allowed 位址的 HTTP 客戶端（測試時可放行本機的測試伺服器）
+func newClient(cfg Config, allowed func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+			}
+			if !allowed(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return CheckURL(req.URL)
+		},
+	}
+}
+
+// Get 以安全客戶端發送 GET 請求，先檢查 URL 協議
+func Get(ctx context.Context, client *http.Client, rawURL string, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,132 @@
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"127.255.255.254", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"169.254.169.254", false}, // 雲端 metadata 服務
+		{"fe80::1", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false}, // 電信級 NAT
+		{"100.127.255.255", false},
+		{"fc00::1", false},
+		{"fec0::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},   // NAT64 對應 10.0.0.1
+		{"2002:a00:1::1", false},    // 6to4 內嵌 10.0.0.1
+		{"2002:c0a8:101::1", false}, // 6to4 內嵌 192.168.1.1
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"255.255.255.255", false},
+		{"198.18.0.1", false},
+		{"192.0.2.1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicIP(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, raw := range []string{"file:///etc/passwd", "gopher://example.com", "ftp://example.com/", "http://"} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckURL(u); err == nil {
+			t.Errorf("CheckURL(%q) = nil, want error", raw)
+		}
+	}
+}
+
+// testConfig 測試用的客戶端設定
+var testConfig = Config{Timeout: 5 * time.Second, MaxRedirects: 3}
+
+func TestClientRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	client := NewClient(testConfig)
+	// localhost 經 DNS（hosts）解析為迴路位址，在建立連線時才會被拒絕
+	for _, raw := range []string{server.URL, "http://localhost" + port, "http://[::ffff:127.0.0.1]" + port} {
+		resp, err := Get(context.Background(), client, raw, nil)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("Get(%s) succeeded, want ErrBlockedAddress", raw)
+			continue
+		}
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Get(%s) = %v, want ErrBlockedAddress", raw, err)
+		}
+	}
+}
+
+func TestClientRejectsRedirectToPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// 將測試伺服器視為公開主機，重定向的目標仍需通過檢查
+	serverAddr := netip.MustParseAddrPort(strings.TrimPrefix(server.URL, "http://")).Addr()
+	client := newClient(testConfig, func(ip netip.Addr) bool {
+		return ip == serverAddr || IsPublicIP(ip)
+	})
+
+	resp, err := Get(context.Background(), client, server.URL, nil)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("redirect to metadata address succeeded, want ErrBlockedAddress")
+	}
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("err = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestClientLimitsRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/again", http.StatusFound)
+	}))
+	defer server.Close()
+
+	serverAddr := netip.MustParseAddrPort(strings.TrimPrefix(server.URL, "http://")).Addr()
+	client := newClient(testConfig, func(ip netip.Addr) bool { return ip == serverAddr })
+
+	resp, err := Get(context.Background(), client, server.URL, nil)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("endless redirects succeeded, want ErrTooManyRedirects")
+	}
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("err = %v, want ErrTooManyRedirects", err)
+	}
+}
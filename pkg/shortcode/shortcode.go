@@ -0,0 +1,239 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultAlphabet 預設的 base62 字母表
+	DefaultAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// DefaultMinLength 預設的最短長度
+	DefaultMinLength = 6
+	// MaxLength 短碼最大長度（與 urls.short_code 欄位長度一致）
+	MaxLength = 16
+
+	// StrategySequential 序號直接以 base62 編碼（可預測）
+	StrategySequential = "sequential"
+	// StrategyObfuscated 序號經過可逆打亂後編碼，看起來像隨機碼但保證不重複
+	StrategyObfuscated = "obfuscated"
+	// StrategyRandom 隨機產生，依賴資料庫唯一鍵處理碰撞
+	StrategyRandom = "random"
+
+	// defaultSecret 未設定 SHORT_CODE_SECRET 時使用的打亂種子
+	defaultSecret = "go-shorturl"
+)
+
+// Generator 短碼產生器
+type Generator interface {
+	// Generate 產生一個新的短碼
+	Generate(ctx context.Context) (string, error)
+}
+
+// Sequence 遞增序號來源（例如資料庫序列），每次呼叫返回不重複的值
+type Sequence interface {
+	NextSequence(ctx context.Context) (uint64, error)
+}
+
+// Config 短碼產生器設定
+type Config struct {
+	Strategy  string // sequential、obfuscated 或 random
+	Alphabet  string // 使用的字元
+	MinLength int    // 最短長度，不足時補位
+	Secret    string // obfuscated 策略的打亂種子
+}
+
+// ConfigFromEnv 從環境變數讀取設定，未設定的項目使用預設值
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Strategy:  os.Getenv("SHORT_CODE_STRATEGY"),
+		Alphabet:  os.Getenv("SHORT_CODE_ALPHABET"),
+		MinLength: DefaultMinLength,
+		Secret:    os.Getenv("SHORT_CODE_SECRET"),
+	}
+	if minLength, err := strconv.Atoi(os.Getenv("SHORT_CODE_MIN_LENGTH")); err == nil {
+		cfg.MinLength = minLength
+	}
+	return cfg
+}
+
+// New 依設定建立短碼產生器，sequential 及 obfuscated 策略需要序號來源
+func New(cfg Config, seq Sequence) (Generator, error) {
+	if cfg.Strategy == "" {
+		cfg.Strategy = StrategyObfuscated
+	}
+	if cfg.Alphabet == "" {
+		cfg.Alphabet = DefaultAlphabet
+	}
+	if cfg.Secret == "" {
+		cfg.Secret = defaultSecret
+	}
+	if cfg.MinLength == 0 {
+		cfg.MinLength = DefaultMinLength
+	}
+	if err := validateAlphabet(cfg.Alphabet); err != nil {
+		return nil, err
+	}
+	if cfg.MinLength < 1 || cfg.MinLength > MaxLength {
+		return nil, fmt.Errorf("short code min length must be between 1 and %d", MaxLength)
+	}
+
+	switch cfg.Strategy {
+	case StrategySequential:
+		return &SequentialGenerator{seq: seq, encoder: NewEncoder(cfg.Alphabet, cfg.MinLength)}, nil
+	case StrategyObfuscated:
+		return &SequentialGenerator{seq: seq, encoder: NewObfuscatedEncoder(cfg.Alphabet, cfg.MinLength, cfg.Secret)}, nil
+	case StrategyRandom:
+		return &RandomGenerator{alphabet: cfg.Alphabet, length: cfg.MinLength}, nil
+	default:
+		return nil, fmt.Errorf("unknown short code strategy %q", cfg.Strategy)
+	}
+}
+
+// NewFromEnv 依環境變數建立短碼產生器
+func NewFromEnv(seq Sequence) (Generator, error) {
+	return New(ConfigFromEnv(), seq)
+}
+
+// validateAlphabet 字母表只能包含不重複的網址安全字元
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return fmt.Errorf("short code alphabet must contain at least 2 characters")
+	}
+	seen := make(map[rune]bool)
+	for _, r := range alphabet {
+		isSafe := (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '-' || r == '_'
+		if !isSafe {
+			return fmt.Errorf("short code alphabet contains unsupported character %q", r)
+		}
+		if seen[r] {
+			return fmt.Errorf("short code alphabet contains duplicate character %q", r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+// Encoder 將非負整數一對一映射為短碼
+//
+// 長度為 L 的短碼依序分配給一段連續的整數區間（最短長度的區間從 0 開始），
+// 區間內的偏移量乘以與字母表大小互質的乘數後取模，因此映射是雙射：
+// 不同的序號永遠得到不同的短碼，乘數不為 1 時相鄰序號的短碼看起來不相關。
+type Encoder struct {
+	alphabet   string
+	base       *big.Int
+	minLength  int
+	multiplier *big.Int
+}
+
+// NewEncoder 建立不打亂的編碼器（序號遞增時短碼也遞增）
+func NewEncoder(alphabet string, minLength int) *Encoder {
+	return &Encoder{
+		alphabet:   alphabet,
+		base:       big.NewInt(int64(len(alphabet))),
+		minLength:  minLength,
+		multiplier: big.NewInt(1),
+	}
+}
+
+// NewObfuscatedEncoder 建立以 secret 打亂字母表順序及序號的編碼器
+func NewObfuscatedEncoder(alphabet string, minLength int, secret string) *Encoder {
+	sum := sha256.Sum256([]byte(secret))
+
+	// 以 secret 決定字母表順序（Fisher-Yates，每一步的亂數取自 secret 的雜湊）
+	chars := []byte(alphabet)
+	for i := len(chars) - 1; i > 0; i-- {
+		step := sha256.Sum256(append(sum[:], byte(i), byte(i>>8)))
+		j := int(binary.BigEndian.Uint64(step[:8]) % uint64(i+1))
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+
+	base := big.NewInt(int64(len(chars)))
+
+	// 乘數必須與字母表大小互質才能保證雙射
+	multiplier := new(big.Int).SetBytes(sum[8:16])
+	one := big.NewInt(1)
+	for new(big.Int).GCD(nil, nil, multiplier, base).Cmp(one) != 0 {
+		multiplier.Add(multiplier, one)
+	}
+
+	return &Encoder{
+		alphabet:   string(chars),
+		base:       base,
+		minLength:  minLength,
+		multiplier: multiplier,
+	}
+}
+
+// Encode 將序號編碼為短碼
+func (e *Encoder) Encode(n uint64) string {
+	offset := new(big.Int).SetUint64(n)
+
+	// 找出序號所在的長度區間
+	length := e.minLength
+	size := new(big.Int).Exp(e.base, big.NewInt(int64(length)), nil)
+	for offset.Cmp(size) >= 0 {
+		offset.Sub(offset, size)
+		length++
+		size.Mul(size, e.base)
+	}
+
+	// 區間內打亂
+	value := new(big.Int).Mul(offset, e.multiplier)
+	value.Mod(value, size)
+
+	code := make([]byte, length)
+	digit := new(big.Int)
+	for i := length - 1; i >= 0; i-- {
+		value.DivMod(value, e.base, digit)
+		code[i] = e.alphabet[digit.Int64()]
+	}
+	return string(code)
+}
+
+// SequentialGenerator 以遞增序號產生短碼，不需要先查詢短碼是否存在
+type SequentialGenerator struct {
+	seq     Sequence
+	encoder *Encoder
+}
+
+// Generate 取得下一個序號並編碼
+func (g *SequentialGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.NextSequence(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get next short code sequence: %w", err)
+	}
+
+	code := g.encoder.Encode(n)
+	if len(code) > MaxLength {
+		return "", fmt.Errorf("short code sequence %d exceeds max length", n)
+	}
+	return code, nil
+}
+
+// RandomGenerator 隨機產生固定長度的短碼
+type RandomGenerator struct {
+	alphabet string
+	length   int
+}
+
+// Generate 產生隨機短碼
+func (g *RandomGenerator) Generate(ctx context.Context) (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(g.alphabet)))
+	for i := 0; i < g.length; i++ {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(g.alphabet[idx.Int64()])
+	}
+	return code.String(), nil
+}
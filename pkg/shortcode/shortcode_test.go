@@ -0,0 +1,106 @@
+package shortcode
+
+import (
+	"math/big"
+	"sort"
+	"testing"
+)
+
+func TestEncoderIsBijectiveAcrossLengths(t *testing.T) {
+	// 小字母表可窮舉：長度 2 的區間為 [0, 100)，長度 3 的區間為 [100, 1100)
+	encoders := map[string]*Encoder{
+		"sequential": NewEncoder("0123456789", 2),
+		"obfuscated": NewObfuscatedEncoder("0123456789", 2, "secret"),
+	}
+	for name, encoder := range encoders {
+		seen := make(map[string]uint64)
+		for n := uint64(0); n < 1100; n++ {
+			code := encoder.Encode(n)
+			wantLength := 2
+			if n >= 100 {
+				wantLength = 3
+			}
+			if len(code) != wantLength {
+				t.Fatalf("%s: Encode(%d) = %q, want length %d", name, n, code, wantLength)
+			}
+			if prev, ok := seen[code]; ok {
+				t.Fatalf("%s: Encode(%d) = Encode(%d) = %q", name, n, prev, code)
+			}
+			seen[code] = n
+		}
+		// 每個長度區間都完整對應到該長度的所有短碼
+		if len(seen) != 100+1000 {
+			t.Errorf("%s: %d distinct codes, want 1100", name, len(seen))
+		}
+	}
+}
+
+func TestEncoderBoundaryWithDefaultAlphabet(t *testing.T) {
+	encoder := NewObfuscatedEncoder(DefaultAlphabet, DefaultMinLength, "secret")
+	boundary := new(big.Int).Exp(big.NewInt(int64(len(DefaultAlphabet))), big.NewInt(DefaultMinLength), nil).Uint64()
+
+	seen := make(map[string]uint64)
+	for n := boundary - 5000; n < boundary+5000; n++ {
+		code := encoder.Encode(n)
+		wantLength := DefaultMinLength
+		if n >= boundary {
+			wantLength = DefaultMinLength + 1
+		}
+		if len(code) != wantLength {
+			t.Fatalf("Encode(%d) = %q, want length %d", n, code, wantLength)
+		}
+		if prev, ok := seen[code]; ok {
+			t.Fatalf("Encode(%d) = Encode(%d) = %q", n, prev, code)
+		}
+		seen[code] = n
+	}
+}
+
+func TestObfuscatedEncoderMultiplierIsCoprime(t *testing.T) {
+	alphabets := []string{"01", "0123456789", DefaultAlphabet, DefaultAlphabet + "-_"}
+	secrets := []string{"", "secret", defaultSecret, "another secret"}
+	one := big.NewInt(1)
+	for _, alphabet := range alphabets {
+		for _, secret := range secrets {
+			encoder := NewObfuscatedEncoder(alphabet, 4, secret)
+			if gcd := new(big.Int).GCD(nil, nil, encoder.multiplier, encoder.base); gcd.Cmp(one) != 0 {
+				t.Errorf("alphabet size %d, secret %q: gcd(multiplier, base) = %s", len(alphabet), secret, gcd)
+			}
+
+			// 打亂後的字母表是原字母表的排列
+			got, want := []byte(encoder.alphabet), []byte(alphabet)
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+			if string(got) != string(want) {
+				t.Errorf("alphabet size %d, secret %q: shuffled alphabet %q is not a permutation", len(alphabet), secret, encoder.alphabet)
+			}
+		}
+	}
+}
+
+func TestValidateAlphabet(t *testing.T) {
+	tests := []struct {
+		alphabet string
+		ok       bool
+	}{
+		{DefaultAlphabet, true},
+		{"01", true},
+		{"abc-_", true},
+		{"", false},
+		{"a", false},
+		{"aba", false},
+		{"0123456789abcdefa", false},
+		{"abc/", false},
+		{"abc ", false},
+		{"abcé", false},
+	}
+	for _, tt := range tests {
+		err := validateAlphabet(tt.alphabet)
+		if (err == nil) != tt.ok {
+			t.Errorf("validateAlphabet(%q) = %v, want ok %v", tt.alphabet, err, tt.ok)
+		}
+		if _, err := New(Config{Alphabet: tt.alphabet}, nil); tt.alphabet != "" && (err == nil) != tt.ok {
+			t.Errorf("New with alphabet %q = %v, want ok %v", tt.alphabet, err, tt.ok)
+		}
+	}
+}